@@ -34,7 +34,9 @@ import (
   "os"
   "fmt"
   "log"
+  "path"
   "regexp"
+  "strconv"
   "strings"
   "reflect"
   "encoding/json"
@@ -42,6 +44,7 @@ import (
   "github.com/google/go-github/v32/github"
 
   "github.com/unikraft/concourse-github-pr-approval-resource/api"
+  "github.com/unikraft/concourse-github-pr-approval-resource/policy"
 )
 
 // Source parameters provided by the resource.
@@ -49,10 +52,11 @@ type Source struct {
   // Meta
   SkipSSLVerification    bool   `json:"skip_ssl"`
   GithubEndpoint         string `json:"github_endpoint"`
+  GithubAPI              string `json:"github_api"`
 
   // The repository to interface with
   Repository             string `json:"repository"`
-  Number                 string `json:"number"`
+  Number            NumberRange `json:"number"`
   DisableGitLfs          bool   `json:"disable_git_lfs"`
 
   // Access methods
@@ -62,28 +66,145 @@ type Source struct {
 
   // Selection criteria
   OnlyMergeable          bool   `json:"only_mergeable"`
+  MergeableStates      []string `json:"mergeable_states"`
+  IncludeDrafts          bool   `json:"include_drafts"`
+  LocalMergeability      bool   `json:"local_mergeability"`
   States               []string `json:"states"`
   Labels               []string `json:"labels"`
-  
+  Numbers         []NumberRange `json:"numbers"`
+  BaseBranches         []string `json:"base_branches"`
+  HeadBranchRegex        string `json:"head_branch_regex"`
+  Authors              []string `json:"authors"`
+  AuthorAssociations   []string `json:"author_associations"`
+  DisableForks           bool   `json:"disable_forks"`
+  Forks                  string `json:"forks"`
+  MinPRAge             Duration `json:"min_pr_age"`
+  ListLookback         Duration `json:"list_lookback"`
+
+  // Approval and review rules, which profiles may override
+  ApprovalRules
+  Profiles           []Profile `json:"profiles"`
+  PolicyPath             string `json:"policy_path"`
+  PolicyFields         []string `json:"policy_fields"`
+
+  IgnoreStates         []string `json:"ignore_states"`
+  IgnoreLabels         []string `json:"ignore_labels"`
+  IgnoreAuthors        []string `json:"ignore_authors"`
+}
+
+// ApprovalRules decide which approvals and reviews count and when a pull
+// request meets the desired state
+type ApprovalRules struct {
+  ApprovalPolicy         string `json:"approval_policy"`
+  ApprovalGroups map[string][]string `json:"approval_groups"`
   MinApprovals           int    `json:"min_approvals"`
   ApproverComments     []string `json:"approver_comments"`
   ApproverTeams        []string `json:"approver_teams"`
+  ApproverUsers        []string `json:"approver_users"`
+  ApproverPermissions  []string `json:"approver_permissions"`
+  ApproverReactions []ReactionRule `json:"approver_reactions"`
   ApproveStates        []string `json:"approve_states"`
+  ApprovalCooldown     Duration `json:"approval_cooldown"`
+  ApprovalMaxAge       Duration `json:"approval_max_age"`
+  RejectTamperedApprovals bool  `json:"reject_tampered_approvals"`
+  IdentitySources      []string `json:"identity_sources"`
+  IdentityFile           string `json:"identity_file"`
+  IdentityMismatch       string `json:"identity_mismatch"`
   MinReviews             int    `json:"min_reviews"`
   ReviewerComments     []string `json:"reviewer_comments"`
   ReviewerTeams        []string `json:"reviewer_teams"`
+  ReviewerUsers        []string `json:"reviewer_users"`
+  ReviewerPermissions  []string `json:"reviewer_permissions"`
   ReviewStates         []string `json:"review_states"`
   RespectAssignees       bool   `json:"respect_assignees"`
   RespectReviewers       bool   `json:"respect_reviewers"`
+  DismissStaleApprovals  bool   `json:"dismiss_stale_approvals"`
+  NativeReviews          bool   `json:"native_reviews"`
+  ReviewComments         bool   `json:"review_comments"`
+  AllowSelfApproval      bool   `json:"allow_self_approval"`
+  IgnoreUsers          []string `json:"ignore_users"`
+  ExcludeCommitters      bool   `json:"exclude_committers"`
+  Codeowners             bool   `json:"codeowners"`
+  AllowUnownedPaths      bool   `json:"allow_unowned_paths"`
+  MaintainersFile        string `json:"maintainers_file"`
+  RequiredStatuses     []string `json:"required_statuses"`
+  RequiredCheckRuns    []string `json:"required_check_runs"`
+  RequireResolvedThreads bool   `json:"require_resolved_threads"`
+  VetoComments         []string `json:"veto_comments"`
+  VetoTeams            []string `json:"veto_teams"`
+  LiftVetoComments     []string `json:"lift_veto_comments"`
+  FreezeWindows  []FreezeWindow `json:"freeze_windows"`
+  FreezeOverrideLabel    string `json:"freeze_override_label"`
+}
 
-  IgnoreStates         []string `json:"ignore_states"`
-  IgnoreLabels         []string `json:"ignore_labels"`
+// NumberRange is a pull request number or an inclusive range of numbers, given
+// either as a number or as a string, e.g. `12`, `"12"` or `"10-20"`
+type NumberRange struct {
+  From int
+  To   int
+}
+
+// UnmarshalJSON decodes a number or a range of numbers
+func (r *NumberRange) UnmarshalJSON(b []byte) error {
+  var number int
+  if err := json.Unmarshal(b, &number); err == nil {
+    r.From, r.To = number, number
+    return nil
+  }
+
+  var s string
+  if err := json.Unmarshal(b, &s); err != nil {
+    return fmt.Errorf("invalid number: %s", b)
+  }
+
+  s = strings.TrimSpace(s)
+  if s == "" {
+    return nil
+  }
+
+  var err error
+  parts := strings.SplitN(s, "-", 2)
+
+  if r.From, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+    return fmt.Errorf("invalid number: %s", s)
+  }
+
+  r.To = r.From
+  if len(parts) == 2 {
+    if r.To, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+      return fmt.Errorf("invalid number: %s", s)
+    }
+  }
+
+  if r.To < r.From {
+    return fmt.Errorf("invalid range: %s", s)
+  }
+
+  return nil
+}
+
+// includes determines whether the number is part of the range
+func (r NumberRange) includes(number int) bool {
+  return number >= r.From && number <= r.To
 }
 
 type Response struct {
-  ReviewID  string `json:"review_id"`
-  CommentID string `json:"comment_id"`
-  CreatedAt string `json:"created_at"`
+  ReviewID        string `json:"review_id"`
+  CommentID       string `json:"comment_id"`
+  ReviewCommentID string `json:"review_comment_id,omitempty"`
+  ReactionID      string `json:"reaction_id,omitempty"`
+  CreatedAt       string `json:"created_at"`
+}
+
+// key uniquely identifies the comment, review, inline comment or reaction of
+// the response
+func (r *Response) key() string {
+  return strings.Join([]string{
+    r.ReviewID,
+    r.CommentID,
+    r.ReviewCommentID,
+    r.ReactionID,
+  }, "/")
 }
 
 // Version communicated with Concourse.
@@ -93,9 +214,97 @@ type Version struct {
   approvedBy []*Response
   ReviewedBy   string    `json:"reviewed_by"`
   reviewedBy []*Response
+  UpdatedAt    string    `json:"updated_at,omitempty"`
+  discarded  []*Discarded
+  flagged    []*Discarded
+  blockedBy  []string
+  vetoedBy   []*Response
+  coverage   []*Coverage
+  statuses   []*Status
+  threads    []*api.ReviewThread
+  policy     *policy.Result
+  freeze     *Freeze
   lastUpdated  int64
 }
 
+// cursor returns the time by which this version was ordered when it was
+// returned.  Versions which predate it fall back to the time of the most recent
+// approval or review recorded as part of them, or zero if they are empty.
+func (v *Version) cursor() (int64, error) {
+  if v.UpdatedAt != "" {
+    updatedAt, err := strconv.ParseInt(v.UpdatedAt, 10, 64)
+    if err != nil {
+      return 0, fmt.Errorf("invalid updated_at: %s", err)
+    }
+
+    return updatedAt, nil
+  }
+
+  var cursor int64
+  var responses []*Response
+
+  for _, field := range []string{v.ApprovedBy, v.ReviewedBy} {
+    if field == "" {
+      continue
+    }
+
+    if err := json.Unmarshal([]byte(field), &responses); err != nil {
+      return 0, fmt.Errorf("could not unmarshal JSON: %s", err)
+    }
+
+    for _, r := range responses {
+      createdAt, err := strconv.ParseInt(r.CreatedAt, 10, 64)
+      if err != nil {
+        return 0, fmt.Errorf("invalid created_at: %s", err)
+      }
+
+      if createdAt > cursor {
+        cursor = createdAt
+      }
+    }
+  }
+
+  return cursor, nil
+}
+
+// equals determines whether two versions represent the same set of approvals
+// and reviews for the same pull request
+func (v *Version) equals(o *Version) bool {
+  return v.PrID == o.PrID &&
+         v.ApprovedBy == o.ApprovedBy &&
+         v.ReviewedBy == o.ReviewedBy
+}
+
+// retains determines whether the version still counts every approval and review
+// of the given version of the same pull request, which is otherwise no longer
+// valid since they have been edited away or deleted
+func (v *Version) retains(o *Version) (bool, error) {
+  counted := make(map[string]bool)
+  for _, r := range append(v.approvedBy, v.reviewedBy...) {
+    counted[r.key()] = true
+  }
+
+  var responses []*Response
+
+  for _, field := range []string{o.ApprovedBy, o.ReviewedBy} {
+    if field == "" {
+      continue
+    }
+
+    if err := json.Unmarshal([]byte(field), &responses); err != nil {
+      return false, fmt.Errorf("could not unmarshal JSON: %s", err)
+    }
+
+    for _, r := range responses {
+      if !counted[r.key()] {
+        return false, nil
+      }
+    }
+  }
+
+  return true, nil
+}
+
 // Metadata has a key name and value
 type MetadataField struct {
   Name  string `json:"name"`
@@ -130,8 +339,13 @@ func serializeStruct(meta interface{}) Metadata {
   typeOfS := v.Type()
 
   for i := 0; i< v.NumField(); i++ {
+    // Unexported fields cannot be read through reflection
+    if typeOfS.Field(i).PkgPath != "" {
+      continue
+    }
+
     res.Add(
-      typeOfS.Field(i).Tag.Get("json"),
+      strings.Split(typeOfS.Field(i).Tag.Get("json"), ",")[0],
       fmt.Sprintf("%v", v.Field(i).Interface()),
     )
   }
@@ -166,6 +380,23 @@ func (source *Source) requestsState(state string) bool {
   return ret
 }
 
+// listStates returns the states of pull requests which should be listed
+func (source *Source) listStates() []string {
+  var states []string
+
+  if len(source.States) == 0 {
+    return []string{"open"}
+  }
+
+  for _, s := range source.States {
+    if source.requestsState(s) {
+      states = append(states, s)
+    }
+  }
+
+  return states
+}
+
 // requestsApproveState checks whether the PR approver matches the desired state
 func (source *Source) requestsApproveState(state string) bool {
   if len(source.ApproveStates) == 0 {
@@ -230,6 +461,127 @@ func (source *Source) requestsLabels(labels []*github.Label) bool {
   return ret
 }
 
+// requestsNumber checks whether the source requests this pull request number
+func (source *Source) requestsNumber(number int) bool {
+  if source.Number.To > 0 && !source.Number.includes(number) {
+    return false
+  }
+
+  if len(source.Numbers) == 0 {
+    return true
+  }
+
+  for _, r := range source.Numbers {
+    if r.includes(number) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// requestsBaseBranch checks whether the source requests this base branch,
+// which may be given as a glob
+func (source *Source) requestsBaseBranch(branch string) bool {
+  if len(source.BaseBranches) == 0 {
+    return true
+  }
+
+  for _, b := range source.BaseBranches {
+    if matched, _ := path.Match(b, branch); matched {
+      return true
+    }
+  }
+
+  return false
+}
+
+// requestsHeadBranch checks whether the source requests this head branch
+func (source *Source) requestsHeadBranch(branch string) (bool, error) {
+  if source.HeadBranchRegex == "" {
+    return true, nil
+  }
+
+  matched, err := regexp.MatchString(source.HeadBranchRegex, branch)
+  if err != nil {
+    return false, fmt.Errorf("invalid head branch regex: %s", err)
+  }
+
+  return matched, nil
+}
+
+// requestsAuthor checks whether the source requests pull requests by this
+// author with the given association to the repository
+func (source *Source) requestsAuthor(username, association string) bool {
+  ret := len(source.Authors) == 0
+  for _, a := range source.Authors {
+    if strings.EqualFold(a, username) {
+      ret = true
+      break
+    }
+  }
+
+  for _, a := range source.IgnoreAuthors {
+    if strings.EqualFold(a, username) {
+      return false
+    }
+  }
+
+  if !ret || len(source.AuthorAssociations) == 0 {
+    return ret
+  }
+
+  for _, a := range source.AuthorAssociations {
+    if strings.EqualFold(a, association) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// forks returns how the source selects pull requests from forks, mapping the
+// legacy disable_forks onto forks.  Setting both is ambiguous and rejected.
+func (source *Source) forks() (string, error) {
+  if source.Forks != "" && source.DisableForks {
+    return "", fmt.Errorf("cannot set both forks and disable_forks")
+  }
+
+  if source.Forks != "" {
+    return source.Forks, nil
+  }
+
+  if source.DisableForks {
+    return "exclude", nil
+  }
+
+  return "include", nil
+}
+
+// requestsFork checks whether the source requests pull requests from forks,
+// which are included unless excluded or exclusively requested by the source
+func (source *Source) requestsFork(pull *github.PullRequest) (bool, error) {
+  forks, err := source.forks()
+  if err != nil {
+    return false, err
+  }
+
+  // The head repository is missing if the fork has been deleted
+  fork := pull.GetHead().GetRepo().GetFullName() !=
+          pull.GetBase().GetRepo().GetFullName()
+
+  switch forks {
+  case "include":
+    return true, nil
+  case "exclude":
+    return !fork, nil
+  case "only":
+    return fork, nil
+  }
+
+  return false, fmt.Errorf("invalid forks: %s", source.Forks)
+}
+
 // requestsReviewerRegex determines if the source requests this reviewer regex
 func (source *Source) requestsReviewerRegex(comment string) bool {
   ret := false
@@ -249,8 +601,14 @@ func (source *Source) requestsReviewerRegex(comment string) bool {
 }
 
 // requestsReviewerTeam determines if the source requests this reviewer team
-func (source *Source) requestsReviewerTeam(c *api.GithubClient, pr github.PullRequest, username string) bool {
+func (source *Source) requestsReviewerTeam(c api.Github, pr github.PullRequest, username string) bool {
   if source.RespectReviewers {
+    if ok, _ := requestedReviewer(c, &pr, username); ok {
+      return true
+    }
+  }
+
+  if includesLogin(source.ReviewerUsers, username) {
     return true
   }
 
@@ -261,7 +619,7 @@ func (source *Source) requestsReviewerTeam(c *api.GithubClient, pr github.PullRe
     }
   }
 
-  return false
+  return hasPermission(c, source.ReviewerPermissions, username)
 }
 
 // hasMinReviewers determines whether the supplied list meets the requested
@@ -294,7 +652,7 @@ func (source *Source) requestsApproverRegex(comment string) bool {
 }
 
 // requestsApproverTeam determines if the source requests this approver team
-func (source *Source) requestsApproverTeam(c *api.GithubClient, pr github.PullRequest, username string) bool {
+func (source *Source) requestsApproverTeam(c api.Github, pr github.PullRequest, username string) bool {
   if source.RespectAssignees {
     for _, assignee := range pr.Assignees {
       if username == *assignee.Login {
@@ -303,6 +661,10 @@ func (source *Source) requestsApproverTeam(c *api.GithubClient, pr github.PullRe
     }
   }
 
+  if includesLogin(source.ApproverUsers, username) {
+    return true
+  }
+
   // Check the named approver teams part of the input to this resource
   for _, t := range source.ApproverTeams {
     if ok, _ := c.UserMemberOfTeam(username, t); ok {
@@ -310,6 +672,39 @@ func (source *Source) requestsApproverTeam(c *api.GithubClient, pr github.PullRe
     }
   }
 
+  return hasPermission(c, source.ApproverPermissions, username)
+}
+
+// includesLogin determines whether the user is any of the listed users, which
+// may be prefixed with `@`
+func includesLogin(users []string, username string) bool {
+  for _, user := range users {
+    if strings.EqualFold(strings.TrimPrefix(user, "@"), username) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// hasPermission determines whether the user has any of the permissions on the
+// repository
+func hasPermission(c api.Github, permissions []string, username string) bool {
+  if len(permissions) == 0 {
+    return false
+  }
+
+  permission, err := c.GetCollaboratorPermission(username)
+  if err != nil {
+    return false
+  }
+
+  for _, p := range permissions {
+    if strings.EqualFold(p, permission) {
+      return true
+    }
+  }
+
   return false
 }
 
@@ -324,6 +719,72 @@ func (source *Source) hasMinApprovers(numApprovers int) bool {
   return numApprovers >= min
 }
 
+// newClient creates the client used to access Github and may be replaced to
+// check against a stub
+var newClient = (*Source).newGithubClient
+
+// newGithubClient returns the client used to gather pull requests and their
+// comments and reviews, either from the v3 (default) or the v4 API
+func (source *Source) newGithubClient() (api.Github, error) {
+  switch source.GithubAPI {
+  case "v3", "":
+    return api.NewGithubClient(
+      source.Repository,
+      source.AccessToken,
+      source.SkipSSLVerification,
+      source.GithubEndpoint,
+    )
+  case "v4":
+    return api.NewGithubV4Client(
+      source.Repository,
+      source.AccessToken,
+      source.SkipSSLVerification,
+      source.GithubEndpoint,
+    )
+  }
+
+  return nil, fmt.Errorf("unknown github api: %s", source.GithubAPI)
+}
+
+// requestsVetoRegex determines if the source requests this veto regex.  Unlike
+// approvals and reviews, no vetoes are recognised if none are set.
+func (source *Source) requestsVetoRegex(comment string) bool {
+  return matchesAny(source.VetoComments, comment)
+}
+
+// requestsLiftVetoRegex determines if the source requests this regex to lift
+// a previous veto
+func (source *Source) requestsLiftVetoRegex(comment string) bool {
+  return matchesAny(source.LiftVetoComments, comment)
+}
+
+// requestsVetoTeam determines if the source requests this veto team, falling
+// back to the approver teams if none are set
+func (source *Source) requestsVetoTeam(c api.Github, pr github.PullRequest, username string) bool {
+  if len(source.VetoTeams) == 0 {
+    return source.requestsApproverTeam(c, pr, username)
+  }
+
+  for _, t := range source.VetoTeams {
+    if ok, _ := c.UserMemberOfTeam(username, t); ok {
+      return true
+    }
+  }
+
+  return false
+}
+
+// matchesAny determines whether the comment matches any of the regexes
+func matchesAny(regexes []string, comment string) bool {
+  for _, r := range regexes {
+    if matched, _ := regexp.MatchString(r, comment); matched {
+      return true
+    }
+  }
+
+  return false
+}
+
 var logger = log.New(os.Stderr, "resource:", log.Lshortfile)
 
 // doOutput ...
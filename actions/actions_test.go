@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "testing"
+
+  "github.com/google/go-github/v32/github"
+)
+
+func TestRequestsFork(t *testing.T) {
+  fork := stubPull(1, 0)
+  fork.Head.Repo = &github.Repository{FullName: github.String("bob/unikraft")}
+  local := stubPull(2, 0)
+
+  tests := []struct {
+    source Source
+    fork   bool
+    local  bool
+    err    bool
+  }{
+    {Source{}, true, true, false},
+    {Source{DisableForks: true}, false, true, false},
+    {Source{Forks: "include"}, true, true, false},
+    {Source{Forks: "exclude"}, false, true, false},
+    {Source{Forks: "only"}, true, false, false},
+    {Source{Forks: "some"}, false, false, true},
+    {Source{Forks: "include", DisableForks: true}, false, false, true},
+  }
+
+  for _, test := range tests {
+    gotFork, err := test.source.requestsFork(fork)
+    if (err != nil) != test.err {
+      t.Errorf("requestsFork(%q, %v): unexpected error: %v", test.source.Forks, test.source.DisableForks, err)
+      continue
+    }
+
+    gotLocal, _ := test.source.requestsFork(local)
+    if gotFork != test.fork || gotLocal != test.local {
+      t.Errorf("requestsFork(%q, %v): expected %v and %v, got %v and %v",
+        test.source.Forks, test.source.DisableForks, test.fork, test.local, gotFork, gotLocal)
+    }
+  }
+
+  // Both settings are rejected before any pull request is listed
+  req := CheckRequest{Source: Source{Forks: "exclude", DisableForks: true}}
+  if _, err := Check(req); err == nil {
+    t.Errorf("Check: expected an error when setting both forks and disable_forks")
+  }
+}
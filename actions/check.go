@@ -32,13 +32,12 @@ package actions
 
 import (
   "os"
-  "fmt"
   "sort"
+  "time"
   "strconv"
   "encoding/json"
 
   "github.com/spf13/cobra"
-  "github.com/unikraft/concourse-github-pr-approval-resource/api"
 )
 
 // CheckCmd ...
@@ -58,6 +57,63 @@ type CheckRequest struct {
 // CheckResponse represents the structure Concourse expects on stdout
 type CheckResponse []Version
 
+// defaultListLookback is how long ago pull requests may have last been updated
+// and still be listed for changes which do not update them, unless set
+const defaultListLookback = 7 * 24 * time.Hour
+
+// listSince returns the time since which pull requests must have been updated
+// in order to produce versions newer than the cursor.  Statuses, check runs,
+// reactions, resolving conversations and changes to the policy file do not
+// update pull requests, so those updated within the list lookback are listed
+// if any are required.  Pull requests which only come of age or are only
+// thawed after the cursor are listed too.  As pull requests may be evaluated
+// against any profile, the earliest time of all of them is used.
+func (source *Source) listSince(cursor int64) time.Time {
+  since := source.rulesSince(cursor)
+
+  for i := range source.Profiles {
+    profiled := source.withProfile(&source.Profiles[i])
+    if t := profiled.rulesSince(cursor); t.Before(since) {
+      since = t
+    }
+  }
+
+  if source.PolicyPath != "" {
+    since = source.lookedBackSince(since)
+  }
+
+  return since
+}
+
+// rulesSince returns the time since which pull requests must have been updated
+// according to the approval rules of the source
+func (source *Source) rulesSince(cursor int64) time.Time {
+  since := source.frozenSince(time.Unix(cursor, 0).Add(-source.lookback()))
+
+  if source.requestsStatuses() ||
+     len(source.ApproverReactions) > 0 ||
+     source.RequireResolvedThreads {
+    since = source.lookedBackSince(since)
+  }
+
+  return since
+}
+
+// lookedBackSince returns the earlier of the given time and the start of the
+// list lookback
+func (source *Source) lookedBackSince(since time.Time) time.Time {
+  lookback := time.Duration(source.ListLookback)
+  if lookback <= 0 {
+    lookback = defaultListLookback
+  }
+
+  if t := now().Add(-lookback); t.Before(since) {
+    return t
+  }
+
+  return since
+}
+
 func doCheckCmd(cmd *cobra.Command, args []string) {
   decoder := json.NewDecoder(os.Stdin)
   decoder.DisallowUnknownFields()
@@ -86,167 +142,129 @@ func doCheckCmd(cmd *cobra.Command, args []string) {
 }
 
 func Check(req CheckRequest) (*CheckResponse, error) {
-  client, err := api.NewGithubClient(
-    req.Source.Repository,
-    req.Source.AccessToken,
-    req.Source.SkipSSLVerification,
-    req.Source.GithubEndpoint,
-  )
-  if err != nil {
+  // Reject an ambiguous configuration even if no pull request is listed
+  if _, err := req.Source.forks(); err != nil {
     return nil, err
   }
 
-  var versions CheckResponse
-  var version *Version
+  client, err := newClient(&req.Source)
+  if err != nil {
+    return nil, err
+  }
 
-  // Get all pull requests
-  pulls, err := client.ListPullRequests()
+  // Use the provided version as a cursor such that only pull requests which
+  // have been updated since are considered
+  cursor, err := req.Version.cursor()
   if err != nil {
     return nil, err
   }
 
-  // Pre-emptively populate list of team members so we can quickly look up
-  // user association as we iterate over reviews and comments of PRs.
-  // var userTeam map[string][]string
-  if len(pulls) > 0 {
-    if len(req.Source.ReviewerTeams) > 0 {
-      for _, team := range req.Source.ReviewerTeams {
-        _, err := client.ListTeamMembers(team)
-        if err != nil {
-          return nil, err
-        }
-      }
-    }
+  var versions CheckResponse
+  var current *Version
+  var holdBack int64
+
+  // The time spent waiting for mergeability is bounded per check
+  mergeabilityWaited = 0
+
+  // Get all pull requests updated since the cursor
+  pulls, err := client.ListPullRequests(
+    req.Source.listStates(),
+    req.Source.listSince(cursor),
+  )
+  if err != nil {
+    return nil, err
   }
 
   // Iterate over all pull requests
   for _, pull := range pulls {
-    if req.Source.Number > 0 && *pull.Number != req.Source.Number {
-      continue
+    selected, err := req.Source.selectsPullRequest(pull)
+    if err != nil {
+      return nil, err
     }
 
-    version = &Version{
-      PrID: strconv.Itoa(*pull.Number),
+    if !selected {
+      continue
     }
 
-    // Ignore if state not requested
-    if !req.Source.requestsState(*pull.State) {
-      continue
+    // The pull request is evaluated against the approval rules of the first
+    // profile which matches it
+    source, _, err := req.Source.forPullRequest(client, pull)
+    if err != nil {
+      return nil, err
     }
 
-    // Ignore if labels not requested
-    if !req.Source.requestsLabels(pull.Labels) {
-      continue
+    version, err := evaluatePullRequest(client, source, pull)
+    if err != nil {
+      return nil, err
     }
 
-    // Ignore if only mergeables requested
-    if req.Source.OnlyMergeable && !*pull.Mergeable {
-      continue
+    // A pull request may only become eligible by an update which is not an
+    // approval or review, e.g. being labelled or marked as ready, after the
+    // cursor has moved on, so versions are ordered by that update too
+    if pull.GetUpdatedAt().Unix() > version.lastUpdated {
+      version.lastUpdated = pull.GetUpdatedAt().Unix()
     }
 
-    // Ignore drafts
-    if *pull.Draft {
+    // The version carries the time it is ordered by, which the next check
+    // then uses as its cursor
+    version.UpdatedAt = strconv.FormatInt(version.lastUpdated, 10)
+
+    // Only save the version if it matches the desired state
+    if !source.satisfiedBy(version) {
       continue
     }
 
-    // Iterate through all the comments for this PR
-    comments, err := client.ListPullRequestComments(int(*pull.Number))
+    // Mergeability is checked last as it may require requesting the pull
+    // request again until Github has computed it
+    mergeable, deferred, err := source.selectsMergeability(client, pull)
     if err != nil {
       return nil, err
     }
 
-    for _, comment := range comments {
-      if req.Source.requestsApproverRegex(*comment.Body) {
-        if req.Source.requestsApproverTeam(client, *pull, *comment.User.Login) {
-          if !req.Source.requestsApproveState("comment") {
-            continue
-          }
-
-          if comment.CreatedAt.Unix() > version.lastUpdated {
-            version.lastUpdated = comment.CreatedAt.Unix()
-          }
-
-          version.approvedBy = append(version.approvedBy, &Response{
-            CreatedAt: strconv.FormatInt(comment.CreatedAt.Unix(), 10),
-            CommentID: strconv.FormatInt(*comment.ID, 10),
-          })
-        }
+    // Hold back newer versions such that the cursor does not move past the
+    // deferred pull request, which is then reconsidered by the next check
+    if deferred {
+      logger.Printf("Deferring pull request #%d: mergeability is unknown", pull.GetNumber())
+
+      if version.lastUpdated > cursor && (holdBack == 0 || version.lastUpdated < holdBack) {
+        holdBack = version.lastUpdated
       }
 
-      if req.Source.requestsReviewerRegex(*comment.Body) {
-        if req.Source.requestsReviewerTeam(client, *pull, *comment.User.Login) {
-          if comment.CreatedAt.Unix() > version.lastUpdated {
-            version.lastUpdated = comment.CreatedAt.Unix()
-          }
-
-          version.reviewedBy = append(version.reviewedBy, &Response{
-            CreatedAt: strconv.FormatInt(comment.CreatedAt.Unix(), 10),
-            CommentID: strconv.FormatInt(*comment.ID, 10),
-          })
-        }
+      if req.Version.PrID != "" && version.PrID == req.Version.PrID {
+        current = &req.Version
       }
-    }
 
-    // Iterate through all the reviews for this PR
-    reviews, err := client.ListPullRequestReviews(int(*pull.Number))
-    if err != nil {
-      return nil, err
+      continue
     }
 
-    for _, review := range reviews {
-      if req.Source.requestsApproverRegex(*review.Body) {
-        if req.Source.requestsApproverTeam(client, *pull, *review.User.Login) {
-          if !req.Source.requestsApproveState(*review.State) {
-            continue
-          }
-
-          if review.SubmittedAt.Unix() > version.lastUpdated {
-            version.lastUpdated = review.SubmittedAt.Unix()
-          }
-
-          version.approvedBy = append(version.approvedBy, &Response{
-            CreatedAt: strconv.FormatInt(review.SubmittedAt.Unix(), 10),
-            ReviewID: strconv.FormatInt(*review.ID, 10),
-          })
-        }
-      }
+    if !mergeable {
+      continue
+    }
 
-      if req.Source.requestsReviewerRegex(*review.Body) {
-        if req.Source.requestsReviewerTeam(client, *pull, *review.User.Login) {
-          if !req.Source.requestsReviewState(*review.State) {
-            continue
-          }
-
-          if review.SubmittedAt.Unix() > version.lastUpdated {
-            version.lastUpdated = review.SubmittedAt.Unix()
-          }
-
-          version.reviewedBy = append(version.reviewedBy, &Response{
-            CreatedAt: strconv.FormatInt(review.SubmittedAt.Unix(), 10),
-            ReviewID: strconv.FormatInt(*review.ID, 10),
-          })
-        }
+    // The provided version is still valid if its pull request still meets the
+    // desired state with all of its approvals and reviews.  Otherwise, it is
+    // superseded by the pull request's current version.
+    if req.Version.PrID != "" && version.PrID == req.Version.PrID {
+      if version.equals(&req.Version) {
+        current = &req.Version
+        continue
       }
-    }
 
-    // Only save the version if it matches the desired state:
-    if req.Source.hasMinApprovers(len(version.approvedBy)) && 
-       req.Source.hasMinReviewers(len(version.reviewedBy)) {
-      
-      // Convert responses to JSON string
-      var out []byte
-      out, err = json.Marshal(version.approvedBy)
+      retained, err := version.retains(&req.Version)
       if err != nil {
-        return nil, fmt.Errorf("could not marshal JSON: %s", err)
+        return nil, err
       }
-      version.ApprovedBy = string(out)
 
-      out, err = json.Marshal(version.reviewedBy)
-      if err != nil {
-        return nil, fmt.Errorf("could not marshal JSON: %s", err)
+      if !retained {
+        versions = append(versions, *version)
+        continue
       }
-      version.ReviewedBy = string(out)
-      
+
+      current = &req.Version
+    }
+
+    // Only return versions which are newer than the cursor
+    if version.lastUpdated > cursor || req.Version.PrID == "" {
       versions = append(versions, *version)
     }
   }
@@ -255,5 +273,19 @@ func Check(req CheckRequest) (*CheckResponse, error) {
     return versions[i].lastUpdated < versions[j].lastUpdated
   })
 
+  if holdBack > 0 {
+    var held CheckResponse
+    for _, version := range versions {
+      if version.lastUpdated < holdBack {
+        held = append(held, version)
+      }
+    }
+    versions = held
+  }
+
+  if current != nil {
+    versions = append(CheckResponse{*current}, versions...)
+  }
+
   return &versions, nil
 }
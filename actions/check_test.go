@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "time"
+  "testing"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// stubGithub serves fixed pull requests and comments.  Any other request
+// panics on the embedded nil client.
+type stubGithub struct {
+  api.Github
+  pulls    []*github.PullRequest
+  comments map[int][]*github.IssueComment
+}
+
+func (c *stubGithub) ListPullRequests(states []string, since time.Time) ([]*github.PullRequest, error) {
+  var pulls []*github.PullRequest
+  for _, pull := range c.pulls {
+    if !pull.GetUpdatedAt().Before(since) {
+      pulls = append(pulls, pull)
+    }
+  }
+
+  return pulls, nil
+}
+
+func (c *stubGithub) GetPullRequest(prID int) (*github.PullRequest, error) {
+  for _, pull := range c.pulls {
+    if pull.GetNumber() == prID {
+      return pull, nil
+    }
+  }
+
+  return nil, fmt.Errorf("could not find pull request: %d", prID)
+}
+
+func (c *stubGithub) ListPullRequestComments(prID int) ([]*github.IssueComment, error) {
+  return c.comments[prID], nil
+}
+
+func (c *stubGithub) ListPullRequestReviews(prID int) ([]*github.PullRequestReview, error) {
+  return nil, nil
+}
+
+// stubPull returns an open pull request last updated at the given time
+func stubPull(number int, updatedAt int64) *github.PullRequest {
+  at := time.Unix(updatedAt, 0)
+  repo := &github.Repository{FullName: github.String("unikraft/unikraft")}
+
+  return &github.PullRequest{
+    Number:    github.Int(number),
+    State:     github.String("open"),
+    User:      &github.User{ID: github.Int64(1), Login: github.String("bob")},
+    CreatedAt: &at,
+    UpdatedAt: &at,
+    Head:      &github.PullRequestBranch{Ref: github.String("feature"), Repo: repo},
+    Base:      &github.PullRequestBranch{Ref: github.String("staging"), Repo: repo},
+  }
+}
+
+// stubComment returns a comment by the user posted at the given time
+func stubComment(id int64, userID int64, login, body string, createdAt int64) *github.IssueComment {
+  at := time.Unix(createdAt, 0)
+
+  return &github.IssueComment{
+    ID:        github.Int64(id),
+    Body:      github.String(body),
+    User:      &github.User{ID: github.Int64(userID), Login: github.String(login)},
+    CreatedAt: &at,
+    UpdatedAt: &at,
+  }
+}
+
+// stubClient replaces the client used by checks for the duration of a test
+func stubClient(t *testing.T, c api.Github) {
+  previous := newClient
+  newClient = func(*Source) (api.Github, error) { return c, nil }
+  t.Cleanup(func() { newClient = previous })
+}
+
+func TestCheckStable(t *testing.T) {
+  // Both pull requests were updated after they were approved, so they are
+  // ordered by their last update rather than by their approvals
+  stubClient(t, &stubGithub{
+    pulls: []*github.PullRequest{stubPull(2, 2000), stubPull(1, 1000)},
+    comments: map[int][]*github.IssueComment{
+      1: {
+        stubComment(11, 2, "alice", "Approved-by: Alice <alice@example.com>", 900),
+        stubComment(12, 3, "carol", "Reviewed-by: Carol <carol@example.com>", 900),
+      },
+      2: {
+        stubComment(21, 2, "alice", "Approved-by: Alice <alice@example.com>", 800),
+        stubComment(22, 3, "carol", "Reviewed-by: Carol <carol@example.com>", 800),
+      },
+    },
+  })
+
+  source := Source{Repository: "unikraft/unikraft"}
+  source.ApproverComments = []string{"Approved-by: .*"}
+  source.ApproverUsers = []string{"alice"}
+  source.ReviewerComments = []string{"Reviewed-by: .*"}
+  source.ReviewerUsers = []string{"carol"}
+  source.MinApprovals = 1
+
+  res, err := Check(CheckRequest{Source: source})
+  if err != nil {
+    t.Fatalf("Check: %s", err)
+  }
+
+  if len(*res) != 2 || (*res)[0].PrID != "1" || (*res)[1].PrID != "2" {
+    t.Fatalf("Check: expected versions of #1 and #2 in order, got %+v", *res)
+  }
+
+  latest := (*res)[1]
+  if latest.UpdatedAt != "2000" {
+    t.Errorf("Check: expected the latest version to be dated 2000, got %q", latest.UpdatedAt)
+  }
+
+  // Checking again from the latest version must only return it again
+  for i := 0; i < 3; i++ {
+    res, err = Check(CheckRequest{Source: source, Version: latest})
+    if err != nil {
+      t.Fatalf("Check: %s", err)
+    }
+
+    if len(*res) != 1 || !(*res)[0].equals(&latest) || (*res)[0].UpdatedAt != latest.UpdatedAt {
+      t.Fatalf("Check %d: expected only the latest version, got %+v", i + 1, *res)
+    }
+
+    latest = (*res)[0]
+  }
+}
@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// The locations of the CODEOWNERS file, in the order Github looks for it
+var codeownersPaths = []string{
+  ".github/CODEOWNERS",
+  "CODEOWNERS",
+  "docs/CODEOWNERS",
+}
+
+// codeownersRule is a single line of a CODEOWNERS file
+type codeownersRule struct {
+  pattern *regexp.Regexp
+  owners  []string
+}
+
+// Coverage reports which owners of a changed path have approved it
+type Coverage struct {
+  Path       string   `json:"path"`
+  Owners     []string `json:"owners"`
+  ApprovedBy []string `json:"approved_by"`
+}
+
+// ownership holds the owners of the paths changed by a pull request
+type ownership struct {
+  coverage []*Coverage
+}
+
+// parseCodeowners parses the rules of a CODEOWNERS file
+func parseCodeowners(data []byte) ([]*codeownersRule, error) {
+  var rules []*codeownersRule
+
+  for i, line := range strings.Split(string(data), "\n") {
+    if j := strings.Index(line, "#"); j >= 0 {
+      line = line[:j]
+    }
+
+    fields := strings.Fields(line)
+    if len(fields) == 0 {
+      continue
+    }
+
+    pattern, err := globRegexp(fields[0], false)
+    if err != nil {
+      return nil, fmt.Errorf("invalid pattern on line %d: %s", i + 1, err)
+    }
+
+    rules = append(rules, &codeownersRule{
+      pattern: pattern,
+      owners:  fields[1:],
+    })
+  }
+
+  return rules, nil
+}
+
+// globRegexp converts a gitignore-style glob into a regular expression.  Globs
+// are anchored to the root of the repository if requested, if they start with
+// a slash or if they contain a slash other than a trailing one.  A glob which
+// names a directory also matches everything beneath it.
+func globRegexp(glob string, anchored bool) (*regexp.Regexp, error) {
+  dir := strings.HasSuffix(glob, "/")
+  glob = strings.TrimSuffix(glob, "/")
+
+  if strings.HasPrefix(glob, "/") || strings.Contains(glob, "/") {
+    anchored = true
+  }
+
+  glob = strings.TrimPrefix(glob, "/")
+
+  var expr strings.Builder
+  if anchored {
+    expr.WriteString("^")
+  } else {
+    expr.WriteString("^(?:.*/)?")
+  }
+
+  for i := 0; i < len(glob); i++ {
+    switch {
+    case strings.HasPrefix(glob[i:], "**/"):
+      expr.WriteString("(?:.*/)?")
+      i += 2
+    case strings.HasPrefix(glob[i:], "**"):
+      expr.WriteString(".*")
+      i++
+    case glob[i] == '*':
+      expr.WriteString("[^/]*")
+    case glob[i] == '?':
+      expr.WriteString("[^/]")
+    default:
+      expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+    }
+  }
+
+  // Directories match everything beneath them, whereas a trailing wildcard
+  // only matches the entries of the directory itself
+  last := glob[strings.LastIndex(glob, "/") + 1:]
+  if dir {
+    expr.WriteString("/.*$")
+  } else if strings.ContainsAny(last, "*?") {
+    expr.WriteString("$")
+  } else {
+    expr.WriteString("(?:/.*)?$")
+  }
+
+  return regexp.Compile(expr.String())
+}
+
+// codeownersOf returns the owners of the path, given by the last rule which
+// matches it
+func codeownersOf(rules []*codeownersRule, path string) []string {
+  var owners []string
+
+  for _, rule := range rules {
+    if rule.pattern.MatchString(path) {
+      owners = rule.owners
+    }
+  }
+
+  return owners
+}
+
+// newOwnership retrieves the CODEOWNERS file from the base branch of the pull
+// request and determines the owners of every path it changes
+func newOwnership(client api.Github, pull *github.PullRequest) (*ownership, error) {
+  var data []byte
+  var err error
+
+  for _, path := range codeownersPaths {
+    data, err = client.GetFileContents(path, pull.GetBase().GetRef())
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve %s: %s", path, err)
+    }
+
+    if data != nil {
+      break
+    }
+  }
+
+  rules, err := parseCodeowners(data)
+  if err != nil {
+    return nil, fmt.Errorf("could not parse CODEOWNERS: %s", err)
+  }
+
+  files, err := client.ListPullRequestFiles(*pull.Number)
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve files: %s", err)
+  }
+
+  o := &ownership{}
+  for _, file := range files {
+    o.coverage = append(o.coverage, &Coverage{
+      Path:       file,
+      Owners:     codeownersOf(rules, file),
+      ApprovedBy: []string{},
+    })
+  }
+
+  return o, nil
+}
+
+// isOwner determines whether the user is the given owner, either by name, by
+// membership of the owning team or by the email address on their profile
+func isOwner(c api.Github, owner, username string) bool {
+  if !strings.HasPrefix(owner, "@") && strings.Contains(owner, "@") {
+    emails, _ := c.ListUserEmails(username)
+    for _, email := range emails {
+      if strings.EqualFold(email, owner) {
+        return true
+      }
+    }
+
+    return false
+  }
+
+  if strings.Contains(owner, "/") {
+    ok, _ := c.UserMemberOfTeam(username, owner)
+    return ok
+  }
+
+  return strings.EqualFold(strings.TrimPrefix(owner, "@"), username)
+}
+
+// approver determines whether the user owns any of the changed paths
+func (o *ownership) approver(c api.Github, username string) bool {
+  for _, coverage := range o.coverage {
+    for _, owner := range coverage.Owners {
+      if isOwner(c, owner, username) {
+        return true
+      }
+    }
+  }
+
+  return false
+}
+
+// approve records the approval of the user for all the paths they own
+func (o *ownership) approve(c api.Github, username string) {
+  for _, coverage := range o.coverage {
+    for _, owner := range coverage.Owners {
+      if isOwner(c, owner, username) {
+        coverage.ApprovedBy = append(coverage.ApprovedBy, username)
+        break
+      }
+    }
+  }
+}
+
+// unapproved returns the owned paths which have not been approved by any of
+// their owners
+func (o *ownership) unapproved() []string {
+  var paths []string
+
+  for _, coverage := range o.coverage {
+    if len(coverage.Owners) > 0 && len(coverage.ApprovedBy) == 0 {
+      paths = append(paths, coverage.Path)
+    }
+  }
+
+  return paths
+}
+
+// unowned returns the changed paths which have no owners, and therefore cannot
+// be approved by one
+func (o *ownership) unowned() []string {
+  var paths []string
+
+  for _, coverage := range o.coverage {
+    if len(coverage.Owners) == 0 {
+      paths = append(paths, coverage.Path)
+    }
+  }
+
+  return paths
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "time"
+  "regexp"
+  "strings"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// Audit is the edit history of an approval together with who introduced its
+// matching text
+type Audit struct {
+  CommentID    int64              `json:"comment_id,omitempty"`
+  ReviewID     int64              `json:"review_id,omitempty"`
+  UserLogin    string             `json:"user_login"`
+  IntroducedBy string             `json:"introduced_by"`
+  IntroducedAt time.Time          `json:"introduced_at"`
+  Edits        []*api.ContentEdit `json:"edits"`
+}
+
+// matchedText returns the text of the body matched by any of the regular
+// expressions, or an empty string if none match
+func matchedText(regexes []string, body string) string {
+  var matches []string
+
+  for _, r := range regexes {
+    re, err := regexp.Compile(r)
+    if err != nil {
+      continue
+    }
+
+    matches = append(matches, re.FindAllString(body, -1)...)
+  }
+
+  return strings.Join(matches, "\n")
+}
+
+// introducedBy returns who introduced the text matched by the regular
+// expressions into the body, and when, by following its edit history.  Without
+// any history, it was introduced by the author when it was posted.
+func introducedBy(edits []*api.ContentEdit, regexes []string, author string, at time.Time) (string, time.Time) {
+  var matched string
+
+  for _, edit := range edits {
+    text := matchedText(regexes, edit.Body)
+    if text != "" && text != matched {
+      author, at = edit.Editor, edit.EditedAt
+    }
+
+    matched = text
+  }
+
+  return author, at
+}
+
+// matchedAt returns the time from which the comment counts, which is when the
+// text matched by the approver and reviewer comments was last changed rather
+// than when the comment was last edited, such that an edit elsewhere in it
+// does not re-date it.  Any edit re-dates the comment if every comment matches
+// or its edit history is unknown.
+func (source *Source) matchedAt(c api.Github, p *post) (time.Time, error) {
+  if p.posted.IsZero() || !p.at.After(p.posted) ||
+     len(source.ApproverComments) == 0 || len(source.ReviewerComments) == 0 {
+    return p.at, nil
+  }
+
+  var regexes []string
+  regexes = append(regexes, source.ApproverComments...)
+  regexes = append(regexes, source.ReviewerComments...)
+
+  if matchedText(regexes, p.body) == "" {
+    return p.at, nil
+  }
+
+  edits, err := c.ListContentEdits(p.nodeID)
+  if err != nil {
+    return time.Time{}, fmt.Errorf("could not retrieve edit history: %s", err)
+  }
+
+  if len(edits) == 0 {
+    return p.at, nil
+  }
+
+  _, at := introducedBy(edits, regexes, p.login(), p.posted)
+
+  return at, nil
+}
+
+// tamperReason returns why the approval does not count when its matching text
+// was introduced by an editor other than its author, or an empty string
+func (source *Source) tamperReason(c api.Github, p *post) (string, error) {
+  edits, err := c.ListContentEdits(p.nodeID)
+  if err != nil {
+    return "", fmt.Errorf("could not retrieve edit history: %s", err)
+  }
+
+  editor, at := introducedBy(edits, source.ApproverComments, p.login(), p.at)
+  if editor == p.login() {
+    return "", nil
+  }
+
+  return fmt.Sprintf(
+    "tampered: approval introduced by %s at %s",
+    editor,
+    at.Format(time.RFC3339),
+  ), nil
+}
@@ -0,0 +1,902 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "sort"
+  "time"
+  "strconv"
+  "strings"
+  "encoding/json"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// Discarded represents an approval or review which matched but was not counted
+type Discarded struct {
+  Response
+  Reason string `json:"reason"`
+}
+
+// selectsPullRequest determines whether the pull request is selected by the
+// source before any of its comments or reviews are considered
+func (source *Source) selectsPullRequest(pull *github.PullRequest) (bool, error) {
+  // Ignore if number not requested
+  if !source.requestsNumber(*pull.Number) {
+    return false, nil
+  }
+
+  // Ignore if state not requested
+  if !source.requestsState(*pull.State) {
+    return false, nil
+  }
+
+  // Ignore if labels not requested
+  if !source.requestsLabels(pull.Labels) {
+    return false, nil
+  }
+
+  // Ignore if branches not requested
+  if !source.requestsBaseBranch(pull.GetBase().GetRef()) {
+    return false, nil
+  }
+
+  if ok, err := source.requestsHeadBranch(pull.GetHead().GetRef()); !ok {
+    return false, err
+  }
+
+  // Ignore if author not requested
+  if !source.requestsAuthor(pull.GetUser().GetLogin(), pull.GetAuthorAssociation()) {
+    return false, nil
+  }
+
+  // Ignore if forks not requested
+  if ok, err := source.requestsFork(pull); !ok {
+    return false, err
+  }
+
+  // Ignore drafts unless requested
+  if pull.GetDraft() && !source.IncludeDrafts {
+    return false, nil
+  }
+
+  return true, nil
+}
+
+// requestsTimeline determines whether the timeline of pull requests is needed
+// to evaluate them
+func (source *Source) requestsTimeline() bool {
+  return source.DismissStaleApprovals || source.NativeReviews
+}
+
+// requestsStatuses determines whether any statuses or check runs are required
+func (source *Source) requestsStatuses() bool {
+  return len(source.RequiredStatuses) > 0 || len(source.RequiredCheckRuns) > 0
+}
+
+// requestsReport determines whether the pull request must be re-evaluated in
+// order to report on what is not part of its version
+func (source *Source) requestsReport() bool {
+  return source.DismissStaleApprovals ||
+         source.NativeReviews ||
+         source.ExcludeCommitters ||
+         source.Codeowners ||
+         source.requestsStatuses() ||
+         source.requestsAges() ||
+         len(source.FreezeWindows) > 0 ||
+         source.RejectTamperedApprovals ||
+         source.requestsIdentities() ||
+         source.RequireResolvedThreads ||
+         source.ApprovalPolicy != "" ||
+         len(source.VetoComments) > 0
+}
+
+// requestsApprover determines whether the author of the post is an eligible
+// approver, which when respecting CODEOWNERS means owning any of the changed
+// paths and when respecting a MAINTAINERS file means maintaining any of them
+func (source *Source) requestsApprover(c api.Github, pull *github.PullRequest, owners *ownership, maintainers *maintainership, p *post) bool {
+  if owners != nil {
+    return owners.approver(c, p.login())
+  }
+
+  if maintainers != nil {
+    return maintainers.approver(source, p)
+  }
+
+  return source.requestsApproverTeam(c, *pull, p.login())
+}
+
+// requestsReviewer determines whether the author of the post is an eligible
+// reviewer, which when respecting a MAINTAINERS file means being listed as a
+// reviewer of any of the changed paths
+func (source *Source) requestsReviewer(c api.Github, pull *github.PullRequest, maintainers *maintainership, p *post) bool {
+  if maintainers != nil {
+    return maintainers.reviewer(source, p)
+  }
+
+  return source.requestsReviewerTeam(c, *pull, p.login())
+}
+
+// requestsThreadStarter determines whether the user who started a conversation
+// on the diff is an eligible approver or reviewer other than the author, which
+// includes the owners and maintainers of the changed paths if respected
+func (source *Source) requestsThreadStarter(c api.Github, pull *github.PullRequest, owners *ownership, maintainers *maintainership, user *github.User) bool {
+  if user.GetID() == pull.GetUser().GetID() || ignoreReason(source.IgnoreUsers, user) != "" {
+    return false
+  }
+
+  p := &post{user: user}
+
+  return source.requestsApprover(c, pull, owners, maintainers, p) ||
+         source.requestsReviewer(c, pull, maintainers, p)
+}
+
+// satisfiedBy determines whether the version meets the desired state, which is
+// decided by the approval policy in place of the minimum number of approvals and
+// reviews if one is set
+func (source *Source) satisfiedBy(version *Version) bool {
+  if version.policy != nil {
+    return len(version.blockedBy) == 0 && version.policy.Satisfied
+  }
+
+  return len(version.blockedBy) == 0 &&
+         source.hasMinApprovers(len(version.approvedBy)) &&
+         source.hasMinReviewers(len(version.reviewedBy))
+}
+
+// headPushedAt returns the time at which the head of the pull request was last
+// pushed, which is the later of its last forced push and the creation of the
+// first check suite for the head commit, both as recorded by Github.  Without
+// check suites, the commit date of the head commit on the timeline is used
+// instead, though it is set by whoever made the commit, and failing that the
+// time the pull request was opened.
+func headPushedAt(c api.Github, pull *github.PullRequest, timeline []*api.TimelineEvent) (time.Time, error) {
+  suites, err := c.ListCheckSuites(pull.GetHead().GetSHA())
+  if err != nil {
+    return time.Time{}, fmt.Errorf("could not retrieve check suites: %s", err)
+  }
+
+  var pushedAt time.Time
+  for _, suite := range suites {
+    if pushedAt.IsZero() || suite.CreatedAt.Before(pushedAt) {
+      pushedAt = suite.CreatedAt
+    }
+  }
+
+  if pushedAt.IsZero() {
+    for _, event := range timeline {
+      if event.Event == "committed" && event.SHA == pull.GetHead().GetSHA() {
+        pushedAt = event.Committer.GetDate()
+      }
+    }
+  }
+
+  if pushedAt.IsZero() {
+    pushedAt = pull.GetCreatedAt()
+  }
+
+  for _, event := range timeline {
+    if event.Event == "head_ref_force_pushed" &&
+       event.CreatedAt != nil && event.CreatedAt.After(pushedAt) {
+      pushedAt = *event.CreatedAt
+    }
+  }
+
+  return pushedAt, nil
+}
+
+// reviewRequestedAt returns the time at which a review was last requested from
+// the user, or zero if it was never requested
+func reviewRequestedAt(timeline []*api.TimelineEvent, userID int64) time.Time {
+  var requestedAt time.Time
+
+  for _, event := range timeline {
+    if event.Event != "review_requested" || event.CreatedAt == nil {
+      continue
+    }
+
+    if event.RequestedReviewer.GetID() != userID {
+      continue
+    }
+
+    if event.CreatedAt.After(requestedAt) {
+      requestedAt = *event.CreatedAt
+    }
+  }
+
+  return requestedAt
+}
+
+// requestedReviewer determines whether a review is requested from the user or
+// one of their teams.  Github no longer lists users as requested reviewers once
+// they have reviewed, so requests which were not removed since are taken from
+// the timeline as well.
+func requestedReviewer(c api.Github, pull *github.PullRequest, login string) (bool, error) {
+  timeline, err := c.ListPullRequestTimeline(pull.GetNumber())
+  if err != nil {
+    return false, fmt.Errorf("could not retrieve timeline: %s", err)
+  }
+
+  users := make(map[string]bool)
+  teams := make(map[string]bool)
+
+  for _, user := range pull.RequestedReviewers {
+    users[strings.ToLower(user.GetLogin())] = true
+  }
+
+  for _, team := range pull.RequestedTeams {
+    teams[team.GetSlug()] = true
+  }
+
+  for _, event := range timeline {
+    if event.Event != "review_requested" && event.Event != "review_request_removed" {
+      continue
+    }
+
+    requested := event.Event == "review_requested"
+
+    if event.RequestedReviewer != nil {
+      users[strings.ToLower(event.RequestedReviewer.GetLogin())] = requested
+    }
+
+    if event.RequestedTeam != nil {
+      teams[event.RequestedTeam.GetSlug()] = requested
+    }
+  }
+
+  if users[strings.ToLower(login)] {
+    return true, nil
+  }
+
+  // Teams are spelled as in `approver_teams` and `reviewer_teams` such that
+  // their members are shared with those lookups
+  org := pull.GetBase().GetRepo().GetOwner().GetLogin()
+
+  for team, requested := range teams {
+    if !requested {
+      continue
+    }
+
+    ok, err := c.UserMemberOfTeam(login, "@" + org + "/" + team)
+    if ok || err != nil {
+      return ok, err
+    }
+  }
+
+  return false, nil
+}
+
+// latestReviews mirrors the branch protection logic of Github, where only the
+// latest review of each user which is not a comment counts.  Dismissed reviews
+// and reviews which have since been re-requested from the user are discarded.
+func latestReviews(version *Version, timeline []*api.TimelineEvent, reviews []*github.PullRequestReview) []*github.PullRequestReview {
+  var latest []*github.PullRequestReview
+  users := make(map[int64]int)
+
+  for _, review := range reviews {
+    if review.GetState() == "COMMENTED" || review.GetState() == "PENDING" {
+      continue
+    }
+
+    if i, ok := users[review.User.GetID()]; ok {
+      if review.GetSubmittedAt().Before(latest[i].GetSubmittedAt()) {
+        continue
+      }
+
+      latest[i] = review
+    } else {
+      users[review.User.GetID()] = len(latest)
+      latest = append(latest, review)
+    }
+  }
+
+  var counted []*github.PullRequestReview
+
+  for _, review := range latest {
+    var reason string
+    requestedAt := reviewRequestedAt(timeline, review.User.GetID())
+
+    if review.GetState() == "DISMISSED" {
+      reason = "dismissed"
+    } else if requestedAt.After(review.GetSubmittedAt()) {
+      reason = fmt.Sprintf(
+        "superseded: review re-requested at %s",
+        requestedAt.Format(time.RFC3339),
+      )
+    }
+
+    if reason == "" {
+      counted = append(counted, review)
+      continue
+    }
+
+    version.discarded = append(version.discarded, &Discarded{
+      Response: Response{
+        CreatedAt: strconv.FormatInt(review.GetSubmittedAt().Unix(), 10),
+        ReviewID:  strconv.FormatInt(review.GetID(), 10),
+      },
+      Reason:   reason,
+    })
+  }
+
+  return counted
+}
+
+// post is a comment or review on a pull request
+type post struct {
+  nodeID   string
+  user     *github.User
+  body     string
+  state    string
+  commitID string
+  posted   time.Time
+  at       time.Time
+  response *Response
+}
+
+// commentPost converts the comment into a post, which counts from the time it
+// was last edited such that an approval added by an edit is not backdated
+func commentPost(comment *github.IssueComment) *post {
+  at := comment.GetCreatedAt()
+  if comment.GetUpdatedAt().After(at) {
+    at = comment.GetUpdatedAt()
+  }
+
+  return &post{
+    nodeID:   comment.GetNodeID(),
+    user:     comment.User,
+    body:     comment.GetBody(),
+    state:    "comment",
+    posted:   comment.GetCreatedAt(),
+    at:       at,
+    response: &Response{
+      CreatedAt: strconv.FormatInt(at.Unix(), 10),
+      CommentID: strconv.FormatInt(comment.GetID(), 10),
+    },
+  }
+}
+
+// reviewCommentPost converts the inline comment into a post, which like any
+// other comment counts from the time it was last edited
+func reviewCommentPost(comment *github.PullRequestComment) *post {
+  at := comment.GetCreatedAt()
+  if comment.GetUpdatedAt().After(at) {
+    at = comment.GetUpdatedAt()
+  }
+
+  return &post{
+    nodeID:   comment.GetNodeID(),
+    user:     comment.User,
+    body:     comment.GetBody(),
+    state:    "comment",
+    posted:   comment.GetCreatedAt(),
+    at:       at,
+    response: &Response{
+      CreatedAt:       strconv.FormatInt(at.Unix(), 10),
+      ReviewCommentID: strconv.FormatInt(comment.GetID(), 10),
+    },
+  }
+}
+
+// reviewPost converts the review into a post
+func reviewPost(review *github.PullRequestReview) *post {
+  return &post{
+    nodeID:   review.GetNodeID(),
+    user:     review.User,
+    body:     review.GetBody(),
+    state:    review.GetState(),
+    commitID: review.GetCommitID(),
+    at:       review.GetSubmittedAt(),
+    response: &Response{
+      CreatedAt: strconv.FormatInt(review.GetSubmittedAt().Unix(), 10),
+      ReviewID:  strconv.FormatInt(review.GetID(), 10),
+    },
+  }
+}
+
+// login returns the login of the user who wrote the post
+func (p *post) login() string {
+  return p.user.GetLogin()
+}
+
+// isReview determines whether the post is a review
+func (p *post) isReview() bool {
+  return p.response.ReviewID != ""
+}
+
+// staleReason returns why the post does not approve the current head of the
+// pull request, or an empty string if it does
+func (p *post) staleReason(pull *github.PullRequest, pushedAt time.Time) string {
+  if p.isReview() {
+    if p.commitID != pull.GetHead().GetSHA() {
+      return fmt.Sprintf(
+        "stale: submitted for %s but the head is %s",
+        p.commitID,
+        pull.GetHead().GetSHA(),
+      )
+    }
+  } else if p.at.Before(pushedAt) {
+    return fmt.Sprintf(
+      "stale: posted before the head was pushed at %s",
+      pushedAt.Format(time.RFC3339),
+    )
+  }
+
+  return ""
+}
+
+// count adds the post to the list of responses unless there is a reason for it
+// to be discarded, and returns whether it was counted
+func (version *Version) count(list *[]*Response, p *post, reason string) bool {
+  if reason != "" {
+    version.discarded = append(version.discarded, &Discarded{
+      Response: *p.response,
+      Reason:   reason,
+    })
+    return false
+  }
+
+  if p.at.Unix() > version.lastUpdated {
+    version.lastUpdated = p.at.Unix()
+  }
+
+  *list = append(*list, p.response)
+
+  return true
+}
+
+// verifyIdentity returns why the post does not count when the identity named
+// by its trailers does not belong to its author.  If mismatches are only to be
+// flagged, the post is recorded as such and still counts.
+func (version *Version) verifyIdentity(mapping *identityMapping, p *post, regexes []string) (string, error) {
+  reason, err := mapping.mismatchReason(p, regexes)
+  if err != nil || reason == "" {
+    return "", err
+  }
+
+  if mapping.flagOnly {
+    version.flagged = append(version.flagged, &Discarded{
+      Response: *p.response,
+      Reason:   reason,
+    })
+    return "", nil
+  }
+
+  return reason, nil
+}
+
+// activeVetoes returns the vetoes on the pull request which have not been
+// lifted since by the same user, as well as the time of the last lift
+func (source *Source) activeVetoes(client api.Github, pull *github.PullRequest, posts []*post) ([]*post, time.Time) {
+  var vetoes []*post
+  var liftedAt time.Time
+
+  sorted := make([]*post, len(posts))
+  copy(sorted, posts)
+
+  sort.SliceStable(sorted, func(i, j int) bool {
+    return sorted[i].at.Before(sorted[j].at)
+  })
+
+  for _, p := range sorted {
+    if ignoreReason(source.IgnoreUsers, p.user) != "" {
+      continue
+    }
+
+    if source.requestsVetoRegex(p.body) {
+      if source.requestsVetoTeam(client, *pull, p.login()) {
+        vetoes = append(vetoes, p)
+      }
+      continue
+    }
+
+    if !source.requestsLiftVetoRegex(p.body) {
+      continue
+    }
+
+    // Lift all vetoes previously given by the same user
+    for i := 0; i < len(vetoes); i++ {
+      if vetoes[i].login() != p.login() {
+        continue
+      }
+
+      vetoes = append(vetoes[:i], vetoes[i+1:]...)
+      liftedAt = p.at
+      i--
+    }
+  }
+
+  return vetoes, liftedAt
+}
+
+// evaluatePullRequest gathers the approvals and reviews of the pull request
+// which match the source into a version
+func evaluatePullRequest(client api.Github, source Source, pull *github.PullRequest) (*Version, error) {
+  version := &Version{
+    PrID: strconv.Itoa(*pull.Number),
+  }
+
+  ids, err := newIdentities(client, source, pull)
+  if err != nil {
+    return nil, err
+  }
+
+  quorum, err := source.approvalPolicy()
+  if err != nil {
+    return nil, err
+  }
+
+  var timeline []*api.TimelineEvent
+  if source.requestsTimeline() {
+    timeline, err = client.ListPullRequestTimeline(*pull.Number)
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve timeline: %s", err)
+    }
+  }
+
+  // Approvals by comment only count for the current head if they were posted
+  // after it was pushed
+  var pushedAt time.Time
+  if source.DismissStaleApprovals {
+    pushedAt, err = headPushedAt(client, pull, timeline)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  // Eligible approvers are the owners of the changed paths
+  var owners *ownership
+  if source.Codeowners {
+    owners, err = newOwnership(client, pull)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  // Identities in trailers must belong to the users who wrote them
+  var mapping *identityMapping
+  if source.requestsIdentities() {
+    mapping, err = newIdentityMapping(client, source, pull)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  // Eligible approvers and reviewers are resolved from the MAINTAINERS file
+  var maintainers *maintainership
+  if source.MaintainersFile != "" {
+    maintainers, err = newMaintainership(client, source, pull, mapping)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  // Gather all the comments and reviews for this PR
+  var posts []*post
+  var counted []*post
+
+  comments, err := client.ListPullRequestComments(int(*pull.Number))
+  if err != nil {
+    return nil, err
+  }
+
+  for _, comment := range comments {
+    posts = append(posts, commentPost(comment))
+  }
+
+  // Inline comments on the diff and replies in review threads
+  if source.ReviewComments {
+    reviewComments, err := client.ListPullRequestReviewComments(int(*pull.Number))
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve review comments: %s", err)
+    }
+
+    for _, comment := range reviewComments {
+      posts = append(posts, reviewCommentPost(comment))
+    }
+  }
+
+  // Edits only re-date comments if they changed the approval or review
+  for _, p := range posts {
+    at, err := source.matchedAt(client, p)
+    if err != nil {
+      return nil, err
+    }
+
+    p.at = at
+    p.response.CreatedAt = strconv.FormatInt(at.Unix(), 10)
+  }
+
+  counted = append(counted, posts...)
+
+  reviews, err := client.ListPullRequestReviews(int(*pull.Number))
+  if err != nil {
+    return nil, err
+  }
+
+  for _, review := range reviews {
+    posts = append(posts, reviewPost(review))
+  }
+
+  if source.NativeReviews {
+    reviews = latestReviews(version, timeline, reviews)
+
+    // Any outstanding request for changes by an eligible approver or reviewer,
+    // including the owners and maintainers of the changed paths, blocks the
+    // pull request entirely
+    for _, review := range reviews {
+      if review.GetState() != "CHANGES_REQUESTED" ||
+         ignoreReason(source.IgnoreUsers, review.User) != "" {
+        continue
+      }
+
+      p := reviewPost(review)
+      if source.requestsApprover(client, pull, owners, maintainers, p) ||
+         source.requestsReviewer(client, pull, maintainers, p) {
+        version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+          "changes requested by %s", *review.User.Login,
+        ))
+      }
+    }
+  }
+
+  for _, review := range reviews {
+    counted = append(counted, reviewPost(review))
+  }
+
+  // Reactions approve the pull request without matching any regex
+  if len(source.ApproverReactions) > 0 {
+    reactions, err := source.reactionPosts(client, pull, comments)
+    if err != nil {
+      return nil, err
+    }
+
+    counted = append(counted, reactions...)
+  }
+
+  // Users counted towards the approval policy
+  var approvers []string
+  var reviewers []string
+
+  // Iterate through all the counted comments and reviews for this PR
+  for _, p := range counted {
+    if (p.isReaction() ||
+        source.requestsApproverRegex(p.body) && source.requestsApproveState(p.state)) &&
+       source.requestsApprover(client, pull, owners, maintainers, p) {
+      var reason string
+      if source.DismissStaleApprovals {
+        reason = p.staleReason(pull, pushedAt)
+      }
+      if reason == "" {
+        reason = source.approvalAgeReason(p)
+      }
+      if reason == "" && mapping != nil {
+        reason, err = version.verifyIdentity(mapping, p, source.ApproverComments)
+        if err != nil {
+          return nil, err
+        }
+      }
+      if reason == "" && source.RejectTamperedApprovals && !p.isReaction() {
+        reason, err = source.tamperReason(client, p)
+        if err != nil {
+          return nil, err
+        }
+      }
+      if reason == "" {
+        reason = ids.admit(ids.approvers, p.user)
+      }
+
+      if version.count(&version.approvedBy, p, reason) {
+        approvers = append(approvers, p.login())
+
+        // The approval only counts once it has cooled down
+        countsAt := p.at.Add(time.Duration(source.ApprovalCooldown))
+        if countsAt.Unix() > version.lastUpdated {
+          version.lastUpdated = countsAt.Unix()
+        }
+
+        if owners != nil {
+          owners.approve(client, p.login())
+        }
+      }
+    }
+
+    if !p.isReaction() &&
+       source.requestsReviewerRegex(p.body) &&
+       source.requestsReviewer(client, pull, maintainers, p) &&
+       (!p.isReview() || source.requestsReviewState(p.state)) {
+      var reason string
+      if source.DismissStaleApprovals {
+        reason = p.staleReason(pull, pushedAt)
+      }
+      if reason == "" && mapping != nil {
+        reason, err = version.verifyIdentity(mapping, p, source.ReviewerComments)
+        if err != nil {
+          return nil, err
+        }
+      }
+      if reason == "" {
+        reason = ids.admit(ids.reviewers, p.user)
+      }
+
+      if version.count(&version.reviewedBy, p, reason) {
+        reviewers = append(reviewers, p.login())
+      }
+    }
+  }
+
+  // The approvals and reviews must satisfy the approval policy
+  if quorum != nil {
+    version.policy, err = quorum.Evaluate(approvers, reviewers, &policyResolver{
+      client:   client,
+      source:   &source,
+      pull:     pull,
+    })
+    if err != nil {
+      return nil, fmt.Errorf("could not evaluate approval policy: %s", err)
+    }
+  }
+
+  // The pull request must have been open for the minimum age
+  if source.MinPRAge > 0 {
+    opened, since := source.openedLongEnough(pull)
+    if !opened {
+      version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+        "open for less than %s until %s",
+        time.Duration(source.MinPRAge),
+        since.Format(time.RFC3339),
+      ))
+    }
+
+    if since.Unix() > version.lastUpdated {
+      version.lastUpdated = since.Unix()
+    }
+  }
+
+  // Every owned path must have been approved by one of its owners
+  if owners != nil {
+    version.coverage = owners.coverage
+    for _, path := range owners.unapproved() {
+      version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+        "no approval by an owner of %s", path,
+      ))
+    }
+
+    // Paths without owners block unless explicitly allowed to pass
+    if !source.AllowUnownedPaths {
+      for _, path := range owners.unowned() {
+        version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+          "no owner of %s", path,
+        ))
+      }
+    }
+  }
+
+  // Any active veto blocks the pull request until it is lifted
+  if len(source.VetoComments) > 0 {
+    vetoes, liftedAt := source.activeVetoes(client, pull, posts)
+    for _, veto := range vetoes {
+      version.vetoedBy = append(version.vetoedBy, veto.response)
+      version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+        "vetoed by %s", veto.login(),
+      ))
+    }
+
+    // The pull request only meets the desired state once the veto is lifted
+    if liftedAt.Unix() > version.lastUpdated {
+      version.lastUpdated = liftedAt.Unix()
+    }
+  }
+
+  // All required statuses and check runs must have succeeded on the head
+  if source.requestsStatuses() {
+    version.statuses, err = source.requiredStatuses(client, pull)
+    if err != nil {
+      return nil, err
+    }
+
+    for _, status := range version.statuses {
+      if !status.passed() {
+        version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+          "%s %s is %s", status.Type, status.Required, status.State,
+        ))
+      } else if status.UpdatedAt.Unix() > version.lastUpdated {
+        version.lastUpdated = status.UpdatedAt.Unix()
+      }
+    }
+  }
+
+  // Conversations started by eligible reviewers must have been resolved
+  if source.RequireResolvedThreads {
+    threads, err := client.ListReviewThreads(*pull.Number)
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve review threads: %s", err)
+    }
+
+    for _, thread := range threads {
+      if thread.Outdated || !source.requestsThreadStarter(client, pull, owners, maintainers, thread.User) {
+        continue
+      }
+
+      // Github records neither a reply nor an event when a conversation is
+      // resolved, so it counts from its last comment, which stays the same
+      // between checks
+      if thread.Resolved {
+        if thread.UpdatedAt.Unix() > version.lastUpdated {
+          version.lastUpdated = thread.UpdatedAt.Unix()
+        }
+        continue
+      }
+
+      version.threads = append(version.threads, thread)
+      version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+        "unresolved conversation by %s on %s", thread.UserLogin, thread.Path,
+      ))
+    }
+  }
+
+  // Merges are withheld during a freeze, such that the pull request only meets
+  // the desired state once all freeze windows it falls in have ended
+  if len(source.FreezeWindows) > 0 && !source.overridesFreeze(pull) {
+    if w, end := source.activeFreeze(pull, now()); w != nil {
+      version.freeze = &Freeze{
+        Name:   w.label(),
+        EndsAt: end,
+      }
+      version.blockedBy = append(version.blockedBy, fmt.Sprintf(
+        "frozen by %s until %s", w.label(), end.Format(time.RFC3339),
+      ))
+    }
+
+    thawedAt := source.thawedAt(pull, time.Unix(version.lastUpdated, 0))
+    if thawedAt.Unix() > version.lastUpdated {
+      version.lastUpdated = thawedAt.Unix()
+    }
+  }
+
+  // Convert responses to JSON string
+  out, err := json.Marshal(version.approvedBy)
+  if err != nil {
+    return nil, fmt.Errorf("could not marshal JSON: %s", err)
+  }
+  version.ApprovedBy = string(out)
+
+  out, err = json.Marshal(version.reviewedBy)
+  if err != nil {
+    return nil, fmt.Errorf("could not marshal JSON: %s", err)
+  }
+  version.ReviewedBy = string(out)
+
+  return version, nil
+}
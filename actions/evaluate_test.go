@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "time"
+  "testing"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// suitesGithub additionally serves fixed check suites for any ref
+type suitesGithub struct {
+  stubGithub
+  suites []*api.CheckSuite
+}
+
+func (c *suitesGithub) ListCheckSuites(ref string) ([]*api.CheckSuite, error) {
+  return c.suites, nil
+}
+
+func TestHeadPushedAt(t *testing.T) {
+  pull := stubPull(1, 1000)
+  pull.Head.SHA = github.String("abc")
+
+  committed := func(sha string, at int64) *api.TimelineEvent {
+    date := time.Unix(at, 0)
+    return &api.TimelineEvent{
+      Event:     "committed",
+      SHA:       sha,
+      Committer: &github.CommitAuthor{Date: &date},
+    }
+  }
+
+  forcePushed := func(at int64) *api.TimelineEvent {
+    date := time.Unix(at, 0)
+    return &api.TimelineEvent{Event: "head_ref_force_pushed", CreatedAt: &date}
+  }
+
+  tests := []struct {
+    name     string
+    suites   []*api.CheckSuite
+    timeline []*api.TimelineEvent
+    want     int64
+  }{
+    {
+      "first check suite",
+      []*api.CheckSuite{{CreatedAt: time.Unix(300, 0)}, {CreatedAt: time.Unix(200, 0)}},
+      []*api.TimelineEvent{committed("abc", 100)},
+      200,
+    },
+    {
+      "later force push",
+      []*api.CheckSuite{{CreatedAt: time.Unix(200, 0)}},
+      []*api.TimelineEvent{forcePushed(100), forcePushed(400)},
+      400,
+    },
+    {
+      "head commit without check suites",
+      nil,
+      []*api.TimelineEvent{committed("def", 100), committed("abc", 150)},
+      150,
+    },
+    {
+      "force push without check suites",
+      nil,
+      []*api.TimelineEvent{committed("abc", 150), forcePushed(400)},
+      400,
+    },
+    {
+      "nothing recorded",
+      nil,
+      nil,
+      1000,
+    },
+  }
+
+  for _, test := range tests {
+    client := &suitesGithub{suites: test.suites}
+
+    got, err := headPushedAt(client, pull, test.timeline)
+    if err != nil {
+      t.Errorf("headPushedAt(%s): %s", test.name, err)
+      continue
+    }
+
+    if got.Unix() != test.want {
+      t.Errorf("headPushedAt(%s): expected %d, got %d", test.name, test.want, got.Unix())
+    }
+  }
+}
+
+func TestStaleReason(t *testing.T) {
+  pull := stubPull(1, 1000)
+  pull.Head.SHA = github.String("abc")
+  pushedAt := time.Unix(200, 0)
+
+  tests := []struct {
+    post  *post
+    stale bool
+  }{
+    {&post{at: time.Unix(100, 0), response: &Response{}}, true},
+    {&post{at: time.Unix(300, 0), response: &Response{}}, false},
+    {&post{at: time.Unix(100, 0), commitID: "abc", response: &Response{ReviewID: "1"}}, false},
+    {&post{at: time.Unix(300, 0), commitID: "def", response: &Response{ReviewID: "1"}}, true},
+  }
+
+  for _, test := range tests {
+    reason := test.post.staleReason(pull, pushedAt)
+    if (reason != "") != test.stale {
+      t.Errorf("staleReason(%d, %q): expected stale %v, got %q",
+        test.post.at.Unix(), test.post.commitID, test.stale, reason)
+    }
+  }
+}
+
+// reviewsGithub additionally serves the CODEOWNERS file, reviews and an empty
+// timeline of pull requests
+type reviewsGithub struct {
+  *profileGithub
+  codeowners string
+  reviews    map[int][]*github.PullRequestReview
+}
+
+func (c *reviewsGithub) GetFileContents(path, ref string) ([]byte, error) {
+  if path != ".github/CODEOWNERS" {
+    return nil, nil
+  }
+
+  return []byte(c.codeowners), nil
+}
+
+func (c *reviewsGithub) ListPullRequestReviews(prID int) ([]*github.PullRequestReview, error) {
+  return c.reviews[prID], nil
+}
+
+func (c *reviewsGithub) ListPullRequestTimeline(prID int) ([]*api.TimelineEvent, error) {
+  return nil, nil
+}
+
+func TestChangesRequestedByOwner(t *testing.T) {
+  at(t, time.Unix(10000, 0))
+
+  pull := stubPull(1, 1000)
+  pull.Head.SHA = github.String("abc")
+
+  submittedAt := time.Unix(2000, 0)
+  c := &reviewsGithub{
+    profileGithub: &profileGithub{
+      stubGithub: &stubGithub{pulls: []*github.PullRequest{pull}},
+      files:      map[int][]string{1: {"lib/a.c"}},
+    },
+    codeowners: "/lib/ @carol\n",
+    reviews: map[int][]*github.PullRequestReview{
+      1: {{
+        ID:          github.Int64(1),
+        User:        &github.User{ID: github.Int64(3), Login: github.String("carol")},
+        State:       github.String("CHANGES_REQUESTED"),
+        CommitID:    github.String("abc"),
+        SubmittedAt: &submittedAt,
+      }},
+    },
+  }
+
+  // The owner of the changed path is not in any approver or reviewer team
+  source := Source{Repository: "unikraft/unikraft"}
+  source.ApproverComments = []string{"Approved-by: .*"}
+  source.Codeowners = true
+  source.NativeReviews = true
+
+  version, err := evaluatePullRequest(c, source, pull)
+  if err != nil {
+    t.Fatalf("evaluatePullRequest: %s", err)
+  }
+
+  for _, reason := range version.blockedBy {
+    if reason == "changes requested by carol" {
+      return
+    }
+  }
+
+  t.Errorf("evaluatePullRequest: expected the owner's request for changes to block, got %v",
+    version.blockedBy)
+}
@@ -0,0 +1,383 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "path"
+  "time"
+  "strconv"
+  "strings"
+  "encoding/json"
+
+  _ "time/tzdata"
+
+  "github.com/google/go-github/v32/github"
+)
+
+// cronBounds are the bounds of the minute, hour, day of month, month and day of
+// week fields of a cron expression, where Sunday is either 0 or 7
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// cronSchedule is a parsed cron expression, where each field is the set of
+// values it matches
+type cronSchedule struct {
+  fields [5]uint64
+  anyDom bool
+  anyDow bool
+}
+
+// parseCron parses a cron expression of five fields, each of which is a list
+// of values, ranges or `*`, optionally with steps, e.g. `0 18 * * 5` or
+// `*/30 9-17 * * 1-5`
+func parseCron(spec string) (*cronSchedule, error) {
+  parts := strings.Fields(spec)
+  if len(parts) != 5 {
+    return nil, fmt.Errorf("invalid cron expression: %s", spec)
+  }
+
+  schedule := &cronSchedule{
+    anyDom: strings.HasPrefix(parts[2], "*"),
+    anyDow: strings.HasPrefix(parts[4], "*"),
+  }
+
+  for i, part := range parts {
+    for _, item := range strings.Split(part, ",") {
+      lo, hi, step, err := parseCronItem(item, cronBounds[i])
+      if err != nil {
+        return nil, fmt.Errorf("invalid cron expression: %s: %s", spec, err)
+      }
+
+      for v := lo; v <= hi; v += step {
+        schedule.fields[i] |= 1 << uint(v)
+      }
+    }
+  }
+
+  // Sunday may be given as either 0 or 7
+  if schedule.fields[4] & (1 << 7) != 0 {
+    schedule.fields[4] |= 1
+  }
+
+  return schedule, nil
+}
+
+// parseCronItem parses a single value, range or `*` of a cron field with an
+// optional step, and returns the range of values with its step
+func parseCronItem(item string, bounds [2]int) (int, int, int, error) {
+  var err error
+  lo, hi, step := bounds[0], bounds[1], 1
+
+  if i := strings.Index(item, "/"); i >= 0 {
+    step, err = strconv.Atoi(item[i+1:])
+    if err != nil || step < 1 {
+      return 0, 0, 0, fmt.Errorf("invalid step: %s", item)
+    }
+
+    item = item[:i]
+  }
+
+  if item == "*" {
+    return lo, hi, step, nil
+  }
+
+  if i := strings.Index(item, "-"); i >= 0 {
+    lo, err = strconv.Atoi(item[:i])
+    if err == nil {
+      hi, err = strconv.Atoi(item[i+1:])
+    }
+  } else {
+    lo, err = strconv.Atoi(item)
+
+    // A single value with a step runs until the end of the field, e.g. `5/15`
+    if step == 1 {
+      hi = lo
+    }
+  }
+
+  if err != nil || lo < bounds[0] || hi > bounds[1] || lo > hi {
+    return 0, 0, 0, fmt.Errorf("invalid value: %s", item)
+  }
+
+  return lo, hi, step, nil
+}
+
+// matches determines whether the minute of the given time is scheduled
+func (s *cronSchedule) matches(t time.Time) bool {
+  if s.fields[0] & (1 << uint(t.Minute())) == 0 ||
+     s.fields[1] & (1 << uint(t.Hour())) == 0 ||
+     s.fields[3] & (1 << uint(t.Month())) == 0 {
+    return false
+  }
+
+  dom := s.fields[2] & (1 << uint(t.Day())) != 0
+  dow := s.fields[4] & (1 << uint(t.Weekday())) != 0
+
+  // As with cron, either day matches if both of them are restricted
+  if s.anyDom || s.anyDow {
+    return dom && dow
+  }
+
+  return dom || dow
+}
+
+// FreezeWindow is a period during which pull requests against the matching
+// base branches must not be merged.  It is either an absolute range of time or
+// recurs at the start times given by a cron expression for a duration.
+type FreezeWindow struct {
+  Name       string   `json:"name"`
+  Branches []string   `json:"branches"`
+  Start      string   `json:"start"`
+  End        string   `json:"end"`
+  Cron       string   `json:"cron"`
+  Duration   Duration `json:"duration"`
+  Timezone   string   `json:"timezone"`
+
+  location  *time.Location
+  start      time.Time
+  end        time.Time
+  schedule  *cronSchedule
+}
+
+// Freeze summarises the freeze window which applies to a pull request
+type Freeze struct {
+  Name   string    `json:"name"`
+  EndsAt time.Time `json:"ends_at"`
+}
+
+// freezeLayouts are the accepted layouts of the start and end of an absolute
+// freeze window, where the end of a date covers the whole day
+var freezeLayouts = []string{
+  time.RFC3339,
+  "2006-01-02T15:04",
+  "2006-01-02 15:04",
+  "2006-01-02",
+}
+
+// parseFreezeTime parses the start or end of an absolute freeze window in the
+// given location
+func parseFreezeTime(s string, loc *time.Location, end bool) (time.Time, error) {
+  for _, layout := range freezeLayouts {
+    t, err := time.ParseInLocation(layout, s, loc)
+    if err != nil {
+      continue
+    }
+
+    if end && layout == "2006-01-02" {
+      t = t.AddDate(0, 0, 1)
+    }
+
+    return t, nil
+  }
+
+  return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
+
+// UnmarshalJSON decodes the freeze window and validates its range or schedule
+func (w *FreezeWindow) UnmarshalJSON(b []byte) error {
+  type freezeWindow FreezeWindow
+  if err := json.Unmarshal(b, (*freezeWindow)(w)); err != nil {
+    return err
+  }
+
+  var err error
+  w.location, err = time.LoadLocation(w.Timezone)
+  if err != nil {
+    return fmt.Errorf("invalid freeze window %s: %s", w.label(), err)
+  }
+
+  if w.Cron != "" {
+    if w.Duration <= 0 {
+      return fmt.Errorf("invalid freeze window %s: no duration", w.label())
+    }
+
+    w.schedule, err = parseCron(w.Cron)
+    if err != nil {
+      return fmt.Errorf("invalid freeze window %s: %s", w.label(), err)
+    }
+
+    return nil
+  }
+
+  w.start, err = parseFreezeTime(w.Start, w.location, false)
+  if err != nil {
+    return fmt.Errorf("invalid freeze window %s: %s", w.label(), err)
+  }
+
+  w.end, err = parseFreezeTime(w.End, w.location, true)
+  if err != nil {
+    return fmt.Errorf("invalid freeze window %s: %s", w.label(), err)
+  }
+
+  if !w.end.After(w.start) {
+    return fmt.Errorf("invalid freeze window %s: ends before it starts", w.label())
+  }
+
+  return nil
+}
+
+// label returns the name of the freeze window, or otherwise its definition
+func (w *FreezeWindow) label() string {
+  if w.Name != "" {
+    return w.Name
+  }
+
+  if w.Cron != "" {
+    return fmt.Sprintf("%s for %s", w.Cron, time.Duration(w.Duration))
+  }
+
+  return fmt.Sprintf("%s to %s", w.Start, w.End)
+}
+
+// covers determines whether the freeze window applies to the base branch
+func (w *FreezeWindow) covers(branch string) bool {
+  if len(w.Branches) == 0 {
+    return true
+  }
+
+  for _, glob := range w.Branches {
+    if matched, _ := path.Match(glob, branch); matched {
+      return true
+    }
+  }
+
+  return false
+}
+
+// occurrence returns the start and end of the occurrence of the freeze window
+// which is active at the given time, if any.  Recurring windows are found by
+// looking back for the latest scheduled start within their duration.
+func (w *FreezeWindow) occurrence(at time.Time) (time.Time, time.Time, bool) {
+  if w.schedule == nil {
+    return w.start, w.end, !at.Before(w.start) && at.Before(w.end)
+  }
+
+  duration := time.Duration(w.Duration)
+
+  for t := at.Truncate(time.Minute); at.Sub(t) < duration; t = t.Add(-time.Minute) {
+    if w.schedule.matches(t.In(w.location)) {
+      return t, t.Add(duration), true
+    }
+  }
+
+  return time.Time{}, time.Time{}, false
+}
+
+// overridesFreeze determines whether the pull request is labelled to be merged
+// regardless of any freeze window
+func (source *Source) overridesFreeze(pull *github.PullRequest) bool {
+  if source.FreezeOverrideLabel == "" {
+    return false
+  }
+
+  for _, label := range pull.Labels {
+    if label.GetName() == source.FreezeOverrideLabel {
+      return true
+    }
+  }
+
+  return false
+}
+
+// activeFreeze returns the freeze window which applies to the pull request at
+// the given time, and when it ends, or nil if there is none
+func (source *Source) activeFreeze(pull *github.PullRequest, at time.Time) (*FreezeWindow, time.Time) {
+  var active *FreezeWindow
+  var end time.Time
+
+  for i := range source.FreezeWindows {
+    w := &source.FreezeWindows[i]
+    if !w.covers(pull.GetBase().GetRef()) {
+      continue
+    }
+
+    if _, e, ok := w.occurrence(at); ok && e.After(end) {
+      active, end = w, e
+    }
+  }
+
+  return active, end
+}
+
+// thawedAt returns the end of the freeze windows applying to the pull request
+// which were active at the given time, following on from adjacent ones, or the
+// given time if none was.  A pull request which first met the desired state
+// during a freeze was withheld until its end, so it only counts from then on
+// and is not passed over by a cursor which moved on during the freeze, while
+// one which met it before the freeze keeps its date.  The result is after the
+// current time if the pull request is still frozen.
+func (source *Source) thawedAt(pull *github.PullRequest, at time.Time) time.Time {
+  for !at.After(now()) {
+    w, end := source.activeFreeze(pull, at)
+    if w == nil {
+      break
+    }
+
+    at = end
+  }
+
+  return at
+}
+
+// frozenSince returns the earliest start of the freeze windows which end after
+// the given time, or the time itself if there is none, such that pull requests
+// which only meet the desired state once the freeze is over are listed too
+func (source *Source) frozenSince(since time.Time) time.Time {
+  earliest := since
+
+  for i := range source.FreezeWindows {
+    w := &source.FreezeWindows[i]
+
+    if w.schedule == nil {
+      if w.end.After(since) && w.start.Before(earliest) {
+        earliest = w.start
+      }
+      continue
+    }
+
+    // The first scheduled start within the duration before the given time
+    start := since.Add(-time.Duration(w.Duration)).Truncate(time.Minute)
+    for t := start; t.Before(since); t = t.Add(time.Minute) {
+      if !t.Add(time.Duration(w.Duration)).After(since) {
+        continue
+      }
+
+      if w.schedule.matches(t.In(w.location)) {
+        if t.Before(earliest) {
+          earliest = t
+        }
+        break
+      }
+    }
+  }
+
+  return earliest
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "time"
+  "testing"
+  "encoding/json"
+
+  "github.com/google/go-github/v32/github"
+)
+
+// freezeSource returns a source with the freeze windows given in JSON
+func freezeSource(t *testing.T, windows string) *Source {
+  source := &Source{}
+  if err := json.Unmarshal([]byte(windows), &source.FreezeWindows); err != nil {
+    t.Fatalf("could not unmarshal freeze windows: %s", err)
+  }
+
+  return source
+}
+
+// utc returns the time of the given day in January 2021 in UTC, where the 1st
+// is a Friday
+func utc(day, hour, minute int) time.Time {
+  return time.Date(2021, 1, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseCron(t *testing.T) {
+  tests := []struct {
+    spec    string
+    at      time.Time
+    matches bool
+  }{
+    {"0 18 * * 5", utc(1, 18, 0), true},
+    {"0 18 * * 5", utc(1, 18, 1), false},
+    {"0 18 * * 5", utc(8, 18, 0), true},
+    {"0 18 * * 5", utc(2, 18, 0), false},
+    {"*/30 9-17 * * 1-5", utc(4, 9, 30), true},
+    {"*/30 9-17 * * 1-5", utc(4, 18, 0), false},
+    {"*/30 9-17 * * 1-5", utc(2, 9, 30), false},
+    {"0 0 * * 7", utc(3, 0, 0), true},
+    {"0 0 1 * 1", utc(1, 0, 0), true},
+    {"0 0 1 * 1", utc(4, 0, 0), true},
+    {"0 0 1 * 1", utc(5, 0, 0), false},
+  }
+
+  for _, test := range tests {
+    schedule, err := parseCron(test.spec)
+    if err != nil {
+      t.Errorf("parseCron(%q): %s", test.spec, err)
+      continue
+    }
+
+    if schedule.matches(test.at) != test.matches {
+      t.Errorf("parseCron(%q): expected %s to match: %t", test.spec, test.at, test.matches)
+    }
+  }
+
+  for _, spec := range []string{"", "0 18 * *", "60 * * * *", "0 18 * * 8", "*/0 * * * *", "5-1 * * * *"} {
+    if _, err := parseCron(spec); err == nil {
+      t.Errorf("parseCron(%q): expected error", spec)
+    }
+  }
+}
+
+func TestOccurrence(t *testing.T) {
+  source := freezeSource(t, `[
+    {"cron": "0 18 * * 5", "duration": "64h"},
+    {"start": "2021-01-20", "end": "2021-01-21"}
+  ]`)
+  weekend, release := &source.FreezeWindows[0], &source.FreezeWindows[1]
+
+  tests := []struct {
+    w     *FreezeWindow
+    at    time.Time
+    start time.Time
+    ok    bool
+  }{
+    {weekend, utc(1, 17, 59), time.Time{}, false},
+    {weekend, utc(1, 18, 0), utc(1, 18, 0), true},
+    {weekend, utc(2, 12, 0), utc(1, 18, 0), true},
+    {weekend, utc(4, 9, 59), utc(1, 18, 0), true},
+    {weekend, utc(4, 10, 0), time.Time{}, false},
+    {release, utc(19, 23, 59), time.Time{}, false},
+    {release, utc(21, 23, 59), utc(20, 0, 0), true},
+    {release, utc(22, 0, 0), time.Time{}, false},
+  }
+
+  for _, test := range tests {
+    start, _, ok := test.w.occurrence(test.at)
+    if ok != test.ok || (ok && !start.Equal(test.start)) {
+      t.Errorf("occurrence(%s) of %s: expected %t from %s, got %t from %s",
+        test.at, test.w.label(), test.ok, test.start, ok, start)
+    }
+  }
+}
+
+func TestThawedAt(t *testing.T) {
+  source := freezeSource(t, `[
+    {"cron": "0 18 * * 5", "duration": "64h"},
+    {"start": "2021-01-11T10:00:00Z", "end": "2021-01-12T10:00:00Z"},
+    {"start": "2021-01-12T10:00:00Z", "end": "2021-01-13T10:00:00Z"},
+    {"branches": ["release/*"], "start": "2021-01-05", "end": "2021-01-06"}
+  ]`)
+  pull := &github.PullRequest{
+    Base: &github.PullRequestBranch{Ref: github.String("staging")},
+  }
+
+  at(t, utc(18, 0, 0))
+
+  tests := []struct {
+    at     time.Time
+    thawed time.Time
+  }{
+    // Met during the weekend freeze, so it only counts from its end
+    {utc(2, 12, 0), utc(4, 10, 0)},
+    // Met before the weekend freeze, so it keeps its date
+    {utc(1, 17, 0), utc(1, 17, 0)},
+    // Adjacent freeze windows are followed on from
+    {utc(11, 12, 0), utc(13, 10, 0)},
+    // Freeze windows of other branches do not apply
+    {utc(5, 12, 0), utc(5, 12, 0)},
+    // Still frozen, so it only counts from after the current time
+    {utc(16, 12, 0), utc(18, 10, 0)},
+  }
+
+  for _, test := range tests {
+    if thawed := source.thawedAt(pull, test.at); !thawed.Equal(test.thawed) {
+      t.Errorf("thawedAt(%s): expected %s, got %s", test.at, test.thawed, thawed)
+    }
+  }
+}
+
+func TestFrozenSince(t *testing.T) {
+  source := freezeSource(t, `[
+    {"cron": "0 18 * * 5", "duration": "64h"},
+    {"start": "2021-01-20", "end": "2021-01-21"}
+  ]`)
+
+  tests := []struct {
+    since  time.Time
+    frozen time.Time
+  }{
+    {utc(2, 12, 0), utc(1, 18, 0)},
+    {utc(1, 12, 0), utc(1, 12, 0)},
+    {utc(20, 12, 0), utc(20, 0, 0)},
+    {utc(22, 12, 0), utc(22, 12, 0)},
+  }
+
+  for _, test := range tests {
+    if frozen := source.frozenSince(test.since); !frozen.Equal(test.frozen) {
+      t.Errorf("frozenSince(%s): expected %s, got %s", test.since, test.frozen, frozen)
+    }
+  }
+}
@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "strings"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// identities determines which users may be counted as independent approvers
+// and reviewers of a pull request, such that each user is only counted once
+// regardless of how many comments or reviews they have left.
+type identities struct {
+  ignored   []string
+  excluded  map[int64]string
+  approvers map[int64]bool
+  reviewers map[int64]bool
+}
+
+// newIdentities returns the identities for the pull request, excluding its
+// author and, if requested, anyone who authored or committed one of its commits
+func newIdentities(client api.Github, source Source, pull *github.PullRequest) (*identities, error) {
+  ids := &identities{
+    ignored:   source.IgnoreUsers,
+    excluded:  make(map[int64]string),
+    approvers: make(map[int64]bool),
+    reviewers: make(map[int64]bool),
+  }
+
+  if !source.AllowSelfApproval && pull.User != nil {
+    ids.excluded[pull.User.GetID()] = fmt.Sprintf(
+      "not independent: %s is the author", pull.User.GetLogin(),
+    )
+  }
+
+  if !source.ExcludeCommitters {
+    return ids, nil
+  }
+
+  commits, err := client.ListPullRequestCommits(*pull.Number)
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve commits: %s", err)
+  }
+
+  for _, commit := range commits {
+    for _, user := range []*github.User{commit.Author, commit.Committer} {
+      if user == nil {
+        continue
+      }
+
+      if _, ok := ids.excluded[user.GetID()]; ok {
+        continue
+      }
+
+      ids.excluded[user.GetID()] = fmt.Sprintf(
+        "not independent: %s contributed %s", user.GetLogin(), commit.GetSHA(),
+      )
+    }
+  }
+
+  return ids, nil
+}
+
+// ignoreReason returns why the user is ignored, which are bots and the listed
+// users, or an empty string if the user is not
+func ignoreReason(ignored []string, user *github.User) string {
+  if user.GetType() == "Bot" {
+    return fmt.Sprintf("ignored: %s is a bot", user.GetLogin())
+  }
+
+  if includesLogin(ignored, user.GetLogin()) {
+    return fmt.Sprintf("ignored: %s is ignored", user.GetLogin())
+  }
+
+  return ""
+}
+
+// admit returns the reason why the user cannot be counted, or an empty string
+// if the user is counted for the first time
+func (ids *identities) admit(counted map[int64]bool, user *github.User) string {
+  if reason := ignoreReason(ids.ignored, user); reason != "" {
+    return reason
+  }
+
+  if reason, ok := ids.excluded[user.GetID()]; ok {
+    return reason
+  }
+
+  if counted[user.GetID()] {
+    return fmt.Sprintf("duplicate: %s is already counted", user.GetLogin())
+  }
+
+  counted[user.GetID()] = true
+
+  return ""
+}
+
+// identityMapping resolves which email addresses belong to which users, such
+// that the identity named in the trailer of an approval or review can be bound
+// to the user who wrote it
+type identityMapping struct {
+  client   api.Github
+  sources  []string
+  flagOnly bool
+  file     map[string][]string
+}
+
+// requestsIdentities determines whether identities in trailers must belong to
+// the users who wrote them
+func (source *Source) requestsIdentities() bool {
+  return len(source.IdentitySources) > 0 || source.IdentityFile != ""
+}
+
+// parseIdentities parses a mailmap-style file, where each line lists a user's
+// login prefixed with `@` followed by their name and email addresses, e.g.
+// `@nderjung Alexander Jung <alex@nderjung.net>`
+func parseIdentities(data []byte) map[string][]string {
+  identities := make(map[string][]string)
+
+  for _, line := range strings.Split(string(data), "\n") {
+    if i := strings.Index(line, "#"); i >= 0 {
+      line = line[:i]
+    }
+
+    var login string
+    for _, field := range strings.Fields(line) {
+      if strings.HasPrefix(field, "@") {
+        login = strings.ToLower(strings.TrimPrefix(field, "@"))
+        break
+      }
+    }
+
+    if login == "" {
+      continue
+    }
+
+    for _, email := range maintainersEmailRegex.FindAllStringSubmatch(line, -1) {
+      identities[login] = append(identities[login], strings.ToLower(email[1]))
+    }
+  }
+
+  return identities
+}
+
+// newIdentityMapping returns the mapping of users to email addresses from the
+// requested sources, amongst `file`, `profile` and `commits`
+func newIdentityMapping(client api.Github, source Source, pull *github.PullRequest) (*identityMapping, error) {
+  m := &identityMapping{
+    client:   client,
+    sources:  source.IdentitySources,
+    flagOnly: source.IdentityMismatch == "flag",
+  }
+
+  switch source.IdentityMismatch {
+  case "", "reject", "flag":
+  default:
+    return nil, fmt.Errorf("invalid identity mismatch: %s", source.IdentityMismatch)
+  }
+
+  if len(m.sources) == 0 {
+    m.sources = []string{"file"}
+  }
+
+  for _, s := range m.sources {
+    switch s {
+    case "profile", "commits":
+    case "file":
+      if source.IdentityFile == "" {
+        return nil, fmt.Errorf("no identity file specified")
+      }
+
+      data, err := client.GetFileContents(
+        source.IdentityFile,
+        pull.GetBase().GetRef(),
+      )
+      if err != nil {
+        return nil, fmt.Errorf("could not retrieve %s: %s", source.IdentityFile, err)
+      }
+
+      m.file = parseIdentities(data)
+    default:
+      return nil, fmt.Errorf("invalid identity source: %s", s)
+    }
+  }
+
+  return m, nil
+}
+
+// owns determines whether the email address belongs to the user according to
+// any of the sources
+func (m *identityMapping) owns(username, email string) (bool, error) {
+  for _, s := range m.sources {
+    var emails []string
+    var err error
+
+    switch s {
+    case "file":
+      emails = m.file[strings.ToLower(username)]
+    case "profile":
+      emails, err = m.client.ListUserEmails(username)
+    case "commits":
+      emails, err = m.client.ListUserCommitEmails(username)
+    }
+
+    if err != nil {
+      return false, fmt.Errorf("could not retrieve emails of %s: %s", username, err)
+    }
+
+    for _, e := range emails {
+      if e == email {
+        return true, nil
+      }
+    }
+  }
+
+  return false, nil
+}
+
+// mismatchReason returns why the identity named by the trailers of the post
+// does not belong to the user who wrote it, or an empty string if it does or
+// if the trailers do not name anyone by email address
+func (m *identityMapping) mismatchReason(p *post, regexes []string) (string, error) {
+  for _, email := range trailerEmails(regexes, p.body) {
+    owned, err := m.owns(p.login(), email)
+    if err != nil {
+      return "", err
+    }
+
+    if !owned {
+      return fmt.Sprintf(
+        "spoofed: %s does not belong to %s", email, p.login(),
+      ), nil
+    }
+  }
+
+  return "", nil
+}
@@ -62,6 +62,7 @@ type InParams struct {
   FetchTags       bool   `json:"fetch_tags"`
   IntegrationTool string `json:"integration_tool"`
   MapMetadata     bool   `json:"map_metadata"`
+  MissingMessages string `json:"missing_messages"`
 }
 
 // InRequest from the check stdin.
@@ -78,8 +79,11 @@ type InResponse struct {
 }
 
 type Message struct {
+  Type              string            `json:"type"`
   CommentID         int64             `json:"comment_id"`
   ReviewID          int64             `json:"review_id"`
+  ReviewCommentID   int64             `json:"review_comment_id"`
+  ReactionID        int64             `json:"reaction_id"`
   Body              string            `json:"body"`
   CreatedAt         time.Time         `json:"created_at"`
   UpdatedAt         time.Time         `json:"updated_at"`
@@ -89,7 +93,12 @@ type Message struct {
   UserID            int64             `json:"user_id"`
   UserAvatarURL     string            `json:"user_avatar_url"`
   UserHTMLURL       string            `json:"user_html_url"`
+  Path              string            `json:"path,omitempty"`
+  Line              int               `json:"line,omitempty"`
+  InReplyTo         int64             `json:"in_reply_to,omitempty"`
+  Missing           bool              `json:"missing"`
   Matches           map[string]string `json:"match"`
+  nodeID            string
 }
 
 type InMetadata struct {
@@ -98,8 +107,10 @@ type InMetadata struct {
   PRHeadSHA         string    `json:"pr_head_sha"`
   PRBaseRef         string    `json:"pr_base_ref"`
   PRBaseSHA         string    `json:"pr_base_sha"`
+  PRMergeableState  string    `json:"pr_mergeable_state"`
   TotalApprovals    int       `json:"total_approvals"`
   TotalReviews      int       `json:"total_reviews"`
+  TotalVetoes       int       `json:"total_vetoes"`
 }
 
 var (
@@ -153,14 +164,33 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
     return nil, err
   }
 
+  // Approvals and reviews are reported according to the approval rules of the
+  // first profile which matches the pull request
+  var profile string
+  req.Source, profile, err = req.Source.forPullRequest(gh, pull)
+  if err != nil {
+    return nil, err
+  }
+
   metadata := InMetadata{
     PRID:           int(prID),
     PRHeadRef:     *pull.Head.Ref,
     PRHeadSHA:     *pull.Head.SHA,
     PRBaseRef:     *pull.Base.Ref,
     PRBaseSHA:     *pull.Base.SHA,
+    PRMergeableState: pull.GetMergeableState(),
     TotalApprovals: 0,
     TotalReviews:   0,
+    TotalVetoes:    0,
+  }
+
+  // Re-evaluate the pull request to report on what is not part of the version
+  var evaluated *Version
+  if req.Source.requestsReport() {
+    evaluated, err = evaluatePullRequest(gh, req.Source, pull)
+    if err != nil {
+      return nil, fmt.Errorf("could not evaluate pull request: %s", err)
+    }
   }
 
   // Write approvals, reviews, version and metadata for reuse in PUT path
@@ -169,8 +199,6 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
     return nil, fmt.Errorf("failed to create output directory: %s", err)
   }
 
-  var reviewID int64
-  var commentID int64
   var approvedBy []Message
   var reviewedBy []Message
   var message *Message
@@ -181,25 +209,14 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
     return nil, fmt.Errorf("could not unmarshal JSON: %s", err)
   }
 
-  for i, approval := range req.Version.approvedBy {
-    reviewID, _ = strconv.ParseInt(approval.ReviewID, 10, 64)
-    commentID, _ = strconv.ParseInt(approval.CommentID, 10, 64)
-
-    if reviewID > 0 {
-      message, err = parseReview(int(prID), reviewID, req.Source.ApproverComments)
-    } else if commentID > 0 {
-      message, err = parseComment(commentID, req.Source.ApproverComments)
-    } else {
-      err = fmt.Errorf("invalid approval: no comment or review id")
-    }
-
+  for _, approval := range req.Version.approvedBy {
+    message, err = req.Params.parseResponse(int(prID), approval, req.Source.ApproverComments)
     if err != nil {
-      return nil, fmt.Errorf("could not parse: %s", err)
+      return nil, fmt.Errorf("could not parse approval: %s", err)
     }
 
-    err = saveMessage(path, i, message)
-    if err != nil {
-      return nil, fmt.Errorf("could not save message: %s", err)
+    if message == nil {
+      continue
     }
 
     approvedBy = append(approvedBy, *message)
@@ -212,31 +229,38 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
     return nil, fmt.Errorf("could not unmarshal JSON: %s", err)
   }
 
-  for i, review := range req.Version.reviewedBy {
-    reviewID, _ = strconv.ParseInt(review.ReviewID, 10, 64)
-    commentID, _ = strconv.ParseInt(review.CommentID, 10, 64)
-
-    if reviewID > 0 {
-      message, err = parseReview(int(prID), reviewID, req.Source.ReviewerComments)
-    } else if commentID > 0 {
-      message, err = parseComment(commentID, req.Source.ReviewerComments)
-    } else {
-      err = fmt.Errorf("invalid review: no comment or review id")
-    }
-
+  for _, review := range req.Version.reviewedBy {
+    message, err = req.Params.parseResponse(int(prID), review, req.Source.ReviewerComments)
     if err != nil {
-      return nil, fmt.Errorf("could not parse: %s", err)
+      return nil, fmt.Errorf("could not parse review: %s", err)
     }
 
-    err = saveMessage(path, i, message)
-    if err != nil {
-      return nil, fmt.Errorf("could not save message: %s", err)
+    if message == nil {
+      continue
     }
 
     reviewedBy = append(reviewedBy, *message)
     metadata.TotalReviews++
   }
 
+  var vetoedBy []Message
+
+  if evaluated != nil {
+    for _, veto := range evaluated.vetoedBy {
+      message, err = req.Params.parseResponse(int(prID), veto, req.Source.VetoComments)
+      if err != nil {
+        return nil, fmt.Errorf("could not parse veto: %s", err)
+      }
+
+      if message == nil {
+        continue
+      }
+
+      vetoedBy = append(vetoedBy, *message)
+      metadata.TotalVetoes++
+    }
+  }
+
   serializedMetadata := serializeStruct(metadata)
   
   for i, approval := range approvedBy {
@@ -251,6 +275,44 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
     }
   }
 
+  // Vetoes are prefixed so that their groups do not collide with those of
+  // approvals and reviews
+  for i, veto := range vetoedBy {
+    serializedMetadata.Add(fmt.Sprintf("vetoed_by_%d", i + 1), veto.UserLogin)
+    for k, v := range veto.Matches {
+      serializedMetadata.Add(fmt.Sprintf("veto_%s_%d", k, i + 1), v)
+    }
+  }
+
+  if req.Source.requestsStatuses() {
+    serializedMetadata.Add("statuses_state", statusesState(evaluated.statuses))
+    for i, status := range evaluated.statuses {
+      serializedMetadata.Add(
+        fmt.Sprintf("status_%d", i + 1),
+        fmt.Sprintf("%s: %s", status.Required, status.State),
+      )
+    }
+  }
+
+  if evaluated != nil && req.Source.IdentityMismatch == "flag" {
+    serializedMetadata.Add("total_flagged", strconv.Itoa(len(evaluated.flagged)))
+  }
+
+  // Expose the freeze which currently withholds the pull request
+  if evaluated != nil && evaluated.freeze != nil {
+    serializedMetadata.Add("freeze", evaluated.freeze.Name)
+    serializedMetadata.Add("freeze_ends_at", evaluated.freeze.EndsAt.Format(time.RFC3339))
+  }
+
+  if profile != "" {
+    serializedMetadata.Add("profile", profile)
+  }
+
+  // Expose which alternative of the approval policy was satisfied
+  if evaluated != nil && evaluated.policy != nil {
+    serializedMetadata.Add("approval_policy_clause", evaluated.policy.Clause)
+  }
+
   b, err := json.Marshal(req.Version)
   if err != nil {
     return nil, fmt.Errorf("failed to marshal version: %s", err)
@@ -278,6 +340,147 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
     }
   }
 
+  // Write which approvals were discarded and why
+  if evaluated != nil {
+    discarded := evaluated.discarded
+    if discarded == nil {
+      discarded = []*Discarded{}
+    }
+
+    b, err = json.Marshal(discarded)
+    if err != nil {
+      return nil, fmt.Errorf("failed to marshal discarded approvals: %s", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(path, "discarded.json"), b, 0644); err != nil {
+      return nil, fmt.Errorf("failed to write discarded approvals: %s", err)
+    }
+  }
+
+  // Write which owners approved which of the changed paths
+  if req.Source.Codeowners {
+    b, err = json.Marshal(evaluated.coverage)
+    if err != nil {
+      return nil, fmt.Errorf("failed to marshal coverage: %s", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(path, "codeowners.json"), b, 0644); err != nil {
+      return nil, fmt.Errorf("failed to write coverage: %s", err)
+    }
+  }
+
+  // Write which approvals and reviews name an identity of someone else
+  if req.Source.requestsIdentities() && req.Source.IdentityMismatch == "flag" {
+    flagged := evaluated.flagged
+    if flagged == nil {
+      flagged = []*Discarded{}
+    }
+
+    b, err = json.Marshal(flagged)
+    if err != nil {
+      return nil, fmt.Errorf("failed to marshal flagged approvals: %s", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(path, "flagged.json"), b, 0644); err != nil {
+      return nil, fmt.Errorf("failed to write flagged approvals: %s", err)
+    }
+  }
+
+  // Write the summary of the required statuses and check runs
+  if req.Source.requestsStatuses() {
+    b, err = json.Marshal(evaluated.statuses)
+    if err != nil {
+      return nil, fmt.Errorf("failed to marshal statuses: %s", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(path, "statuses.json"), b, 0644); err != nil {
+      return nil, fmt.Errorf("failed to write statuses: %s", err)
+    }
+  }
+
+  // Write the edit history of every approval
+  if req.Source.RejectTamperedApprovals {
+    audits := []*Audit{}
+
+    for _, approval := range approvedBy {
+      if approval.Missing || approval.Type == "reaction" {
+        continue
+      }
+
+      edits, err := gh.ListContentEdits(approval.nodeID)
+      if err != nil {
+        return nil, fmt.Errorf("could not retrieve edit history: %s", err)
+      }
+
+      if edits == nil {
+        edits = []*api.ContentEdit{}
+      }
+
+      audit := &Audit{
+        CommentID: approval.CommentID,
+        ReviewID:  approval.ReviewID,
+        UserLogin: approval.UserLogin,
+        Edits:     edits,
+      }
+
+      audit.IntroducedBy, audit.IntroducedAt = introducedBy(
+        edits,
+        req.Source.ApproverComments,
+        approval.UserLogin,
+        approval.CreatedAt,
+      )
+
+      audits = append(audits, audit)
+    }
+
+    b, err = json.Marshal(audits)
+    if err != nil {
+      return nil, fmt.Errorf("failed to marshal audit: %s", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(path, "audit.json"), b, 0644); err != nil {
+      return nil, fmt.Errorf("failed to write audit: %s", err)
+    }
+  }
+
+  // Write the conversations which are yet to be resolved
+  if req.Source.RequireResolvedThreads {
+    threads := evaluated.threads
+    if threads == nil {
+      threads = []*api.ReviewThread{}
+    }
+
+    b, err = json.Marshal(threads)
+    if err != nil {
+      return nil, fmt.Errorf("failed to marshal threads: %s", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(path, "threads.json"), b, 0644); err != nil {
+      return nil, fmt.Errorf("failed to write threads: %s", err)
+    }
+  }
+
+  // Write the paths which conflict when merging into the base
+  if req.Source.LocalMergeability && pull.GetState() == "open" {
+    _, conflicts, err := req.Source.localMergeability(pull)
+    if err != nil {
+      return nil, fmt.Errorf("could not compute mergeability: %s", err)
+    }
+
+    if conflicts == nil {
+      conflicts = []string{}
+    }
+
+    b, err = json.Marshal(conflicts)
+    if err != nil {
+      return nil, fmt.Errorf("failed to marshal conflicts: %s", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(path, "conflicts.json"), b, 0644); err != nil {
+      return nil, fmt.Errorf("failed to write conflicts: %s", err)
+    }
+  }
+
   if req.Params.MapMetadata {
     err = writeMap(approvedBy, filepath.Join(path, "approval"))
     if err != nil {
@@ -288,6 +491,11 @@ func In(outputDir string, req InRequest) (*InResponse, error) {
     if err != nil {
       return nil, fmt.Errorf("cannot write map: %s", err)
     }
+
+    err = writeMap(vetoedBy, filepath.Join(path, "veto"))
+    if err != nil {
+      return nil, fmt.Errorf("cannot write map: %s", err)
+    }
   }
 
   if !req.Params.SkipDownload {
@@ -387,6 +595,7 @@ func getParams(regEx, body string) (paramsMap map[string]string) {
   return paramsMap
 }
 
+// parseReview retrieves the review as a message, or nil if it has been deleted
 func parseReview(prID int, reviewID int64, regex []string) (*Message, error) {
   review, err := gh.GetPullRequestReview(
     prID,
@@ -394,9 +603,13 @@ func parseReview(prID int, reviewID int64, regex []string) (*Message, error) {
   )
   if err != nil {
     return nil, fmt.Errorf("could not retrieve review: %s", err)
+  } else if review == nil {
+    return nil, nil
   }
 
   message := &Message{
+    Type:              "review",
+    nodeID:            review.GetNodeID(),
     ReviewID:         *review.ID,
     Body:              *review.Body,
     CreatedAt:         *review.SubmittedAt,
@@ -418,15 +631,20 @@ func parseReview(prID int, reviewID int64, regex []string) (*Message, error) {
   return message, nil
 }
 
+// parseComment retrieves the comment as a message, or nil if it has been deleted
 func parseComment(commentID int64, regex []string) (*Message, error) {
   comment, err := gh.GetPullRequestComment(
     commentID,
   )
   if err != nil {
-    return nil, fmt.Errorf("could not retrieve review: %s", err)
+    return nil, fmt.Errorf("could not retrieve comment: %s", err)
+  } else if comment == nil {
+    return nil, nil
   }
 
   message := &Message{
+    Type:              "comment",
+    nodeID:            comment.GetNodeID(),
     CommentID:         *comment.ID,
     Body:              *comment.Body,
     CreatedAt:         *comment.CreatedAt,
@@ -448,9 +666,135 @@ func parseComment(commentID int64, regex []string) (*Message, error) {
   return message, nil
 }
 
-// saveMessage ...
-func saveMessage(path string, id int, message *Message) error {
-  return nil
+// parseReviewComment retrieves the inline comment as a message, or nil if it has
+// been deleted
+func parseReviewComment(commentID int64, regex []string) (*Message, error) {
+  comment, err := gh.GetPullRequestReviewComment(
+    commentID,
+  )
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve review comment: %s", err)
+  } else if comment == nil {
+    return nil, nil
+  }
+
+  message := &Message{
+    Type:              "review_comment",
+    nodeID:            comment.GetNodeID(),
+    ReviewCommentID:   comment.GetID(),
+    ReviewID:          comment.GetPullRequestReviewID(),
+    Body:              comment.GetBody(),
+    CreatedAt:         comment.GetCreatedAt(),
+    UpdatedAt:         comment.GetUpdatedAt(),
+    AuthorAssociation: comment.GetAuthorAssociation(),
+    HTMLURL:           comment.GetHTMLURL(),
+    UserLogin:         comment.User.GetLogin(),
+    UserID:            comment.User.GetID(),
+    UserAvatarURL:     comment.User.GetAvatarURL(),
+    UserHTMLURL:       comment.User.GetHTMLURL(),
+    Path:              comment.GetPath(),
+    Line:              comment.GetLine(),
+    InReplyTo:         comment.GetInReplyTo(),
+  }
+
+  message.Matches = make(map[string]string)
+  for _, r := range regex {
+    for k, v := range getParams(r, comment.GetBody()) {
+      message.Matches[k] = v
+    }
+  }
+
+  return message, nil
+}
+
+// parseReaction retrieves the reaction to the pull request, or to one of its
+// comments if given, as a message whose body is the content of the reaction,
+// or nil if it has been deleted
+func parseReaction(prID int, commentID int64, reactionID int64) (*Message, error) {
+  var err error
+  var reactions []*api.Reaction
+
+  if commentID > 0 {
+    reactions, err = gh.ListCommentReactions(commentID)
+  } else {
+    reactions, err = gh.ListPullRequestReactions(prID)
+  }
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve reactions: %s", err)
+  }
+
+  for _, reaction := range reactions {
+    if reaction.ID != reactionID {
+      continue
+    }
+
+    return &Message{
+      Type:          "reaction",
+      nodeID:        reaction.NodeID,
+      CommentID:     commentID,
+      ReactionID:    reaction.ID,
+      Body:          reaction.Content,
+      CreatedAt:     reaction.CreatedAt,
+      UpdatedAt:     reaction.CreatedAt,
+      UserLogin:     reaction.User.GetLogin(),
+      UserID:        reaction.User.GetID(),
+      UserAvatarURL: reaction.User.GetAvatarURL(),
+      UserHTMLURL:   reaction.User.GetHTMLURL(),
+      Matches:       map[string]string{},
+    }, nil
+  }
+
+  return nil, nil
+}
+
+// parseResponse retrieves the comment or review of the response as a message.
+// If it has since been deleted, the request either fails, the response is
+// skipped by returning nil, or a snapshot is made from what the version holds.
+func (params *InParams) parseResponse(prID int, response *Response, regex []string) (*Message, error) {
+  reviewID, _ := strconv.ParseInt(response.ReviewID, 10, 64)
+  commentID, _ := strconv.ParseInt(response.CommentID, 10, 64)
+  reactionID, _ := strconv.ParseInt(response.ReactionID, 10, 64)
+  reviewCommentID, _ := strconv.ParseInt(response.ReviewCommentID, 10, 64)
+
+  var err error
+  var message *Message
+
+  if reactionID > 0 {
+    message, err = parseReaction(prID, commentID, reactionID)
+  } else if reviewCommentID > 0 {
+    message, err = parseReviewComment(reviewCommentID, regex)
+  } else if reviewID > 0 {
+    message, err = parseReview(prID, reviewID, regex)
+  } else if commentID > 0 {
+    message, err = parseComment(commentID, regex)
+  } else {
+    return nil, fmt.Errorf("no comment or review id")
+  }
+
+  if err != nil || message != nil {
+    return message, err
+  }
+
+  switch params.MissingMessages {
+  case "fail", "":
+    return nil, fmt.Errorf("comment, review or reaction no longer exists: %+v",
+      *response)
+  case "skip":
+    return nil, nil
+  case "snapshot":
+    createdAt, _ := strconv.ParseInt(response.CreatedAt, 10, 64)
+    return &Message{
+      CommentID:       commentID,
+      ReviewID:        reviewID,
+      ReviewCommentID: reviewCommentID,
+      ReactionID:      reactionID,
+      CreatedAt:       time.Unix(createdAt, 0).UTC(),
+      Missing:         true,
+      Matches:         map[string]string{},
+    }, nil
+  }
+
+  return nil, fmt.Errorf("invalid missing messages policy: %s", params.MissingMessages)
 }
 
 // writeMap writes the metadata of a review or comment to the parent path
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestWriteMap(t *testing.T) {
+  dir, err := ioutil.TempDir("", "messages")
+  if err != nil {
+    t.Fatalf("could not create directory: %s", err)
+  }
+  defer os.RemoveAll(dir)
+
+  messages := []Message{{
+    CommentID: 12,
+    Body:      "Approved-by: Alice <alice@example.com>",
+    UserLogin: "alice",
+    Path:      "lib/a.c",
+    Matches:   map[string]string{"approved_by": "Alice <alice@example.com>"},
+    nodeID:    "IC_12",
+  }}
+
+  if err := writeMap(messages, dir); err != nil {
+    t.Fatalf("writeMap: %s", err)
+  }
+
+  want := map[string]string{
+    "comment_id":  "12",
+    "user_login":  "alice",
+    "path":        "lib/a.c",
+    "approved_by": "Alice <alice@example.com>",
+  }
+
+  for name, value := range want {
+    b, err := ioutil.ReadFile(filepath.Join(dir, "1", name))
+    if err != nil {
+      t.Errorf("writeMap: could not read %s: %s", name, err)
+      continue
+    }
+
+    if string(b) != value {
+      t.Errorf("writeMap: expected %s to be %q, got %q", name, value, b)
+    }
+  }
+
+  if _, err := os.Stat(filepath.Join(dir, "1", "match")); !os.IsNotExist(err) {
+    t.Errorf("writeMap: expected no file for the matches themselves")
+  }
+}
@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+var (
+  maintainersLineRegex  = regexp.MustCompile(`^([A-Z]):\s*(.*)$`)
+  maintainersEmailRegex = regexp.MustCompile(`<([^>]+@[^>]+)>`)
+)
+
+// maintainer is a person listed in a MAINTAINERS file, known by their Github
+// login, their email address or both
+type maintainer struct {
+  login string
+  email string
+}
+
+// maintainersSection is a single subsystem of a MAINTAINERS file
+type maintainersSection struct {
+  name        string
+  maintainers []*maintainer
+  reviewers   []*maintainer
+  files       []*regexp.Regexp
+  excludes    []*regexp.Regexp
+}
+
+// maintainership holds the maintainers and reviewers of the paths changed by a
+// pull request
+type maintainership struct {
+  maintainers []*maintainer
+  reviewers   []*maintainer
+  mapping     *identityMapping
+}
+
+// parseMaintainer parses the value of an M: or R: entry, which is either a
+// `@login`, a `Name <email>` or a `Name <email> @login`
+func parseMaintainer(value string) *maintainer {
+  m := &maintainer{}
+
+  if match := maintainersEmailRegex.FindStringSubmatch(value); match != nil {
+    m.email = strings.ToLower(match[1])
+  }
+
+  for _, field := range strings.Fields(value) {
+    if strings.HasPrefix(field, "@") {
+      m.login = strings.TrimPrefix(field, "@")
+    }
+  }
+
+  if m.login == "" && m.email == "" && len(strings.Fields(value)) == 1 {
+    m.login = value
+  }
+
+  return m
+}
+
+// parseMaintainers parses a Linux kernel-style MAINTAINERS file, where each
+// section starts with its name followed by one entry per line
+func parseMaintainers(data []byte) ([]*maintainersSection, error) {
+  var sections []*maintainersSection
+  var section *maintainersSection
+
+  for i, line := range strings.Split(string(data), "\n") {
+    line = strings.TrimSpace(line)
+    if line == "" {
+      section = nil
+      continue
+    }
+
+    match := maintainersLineRegex.FindStringSubmatch(line)
+    if match == nil {
+      section = &maintainersSection{
+        name: line,
+      }
+      sections = append(sections, section)
+      continue
+    }
+
+    // Entries before the first section are part of the preamble
+    if section == nil {
+      continue
+    }
+
+    switch match[1] {
+    case "M":
+      section.maintainers = append(section.maintainers, parseMaintainer(match[2]))
+    case "R":
+      section.reviewers = append(section.reviewers, parseMaintainer(match[2]))
+    case "F", "X":
+      pattern, err := globRegexp(match[2], true)
+      if err != nil {
+        return nil, fmt.Errorf("invalid pattern on line %d: %s", i + 1, err)
+      }
+
+      if match[1] == "F" {
+        section.files = append(section.files, pattern)
+      } else {
+        section.excludes = append(section.excludes, pattern)
+      }
+    }
+  }
+
+  return sections, nil
+}
+
+// covers determines whether the section is responsible for the path
+func (section *maintainersSection) covers(path string) bool {
+  for _, exclude := range section.excludes {
+    if exclude.MatchString(path) {
+      return false
+    }
+  }
+
+  for _, file := range section.files {
+    if file.MatchString(path) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// newMaintainership retrieves the MAINTAINERS file from the base branch of the
+// pull request and resolves the maintainers and reviewers of the paths it
+// changes.  Entries are only matched by email address if the mapping binds the
+// address to the user who wrote it.
+func newMaintainership(client api.Github, source Source, pull *github.PullRequest, mapping *identityMapping) (*maintainership, error) {
+  data, err := client.GetFileContents(
+    source.MaintainersFile,
+    pull.GetBase().GetRef(),
+  )
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve %s: %s", source.MaintainersFile, err)
+  }
+
+  sections, err := parseMaintainers(data)
+  if err != nil {
+    return nil, fmt.Errorf("could not parse %s: %s", source.MaintainersFile, err)
+  }
+
+  files, err := client.ListPullRequestFiles(*pull.Number)
+  if err != nil {
+    return nil, fmt.Errorf("could not retrieve files: %s", err)
+  }
+
+  m := &maintainership{
+    mapping: mapping,
+  }
+  for _, section := range sections {
+    for _, file := range files {
+      if section.covers(file) {
+        m.maintainers = append(m.maintainers, section.maintainers...)
+        m.reviewers = append(m.reviewers, section.reviewers...)
+        break
+      }
+    }
+  }
+
+  return m, nil
+}
+
+// trailerEmails returns the email addresses within the parts of the body which
+// match any of the regexes, e.g. `Approved-by: Name <email>`
+func trailerEmails(regexes []string, body string) []string {
+  var emails []string
+
+  for _, r := range regexes {
+    re, err := regexp.Compile(r)
+    if err != nil {
+      continue
+    }
+
+    for _, match := range re.FindAllString(body, -1) {
+      for _, email := range maintainersEmailRegex.FindAllStringSubmatch(match, -1) {
+        emails = append(emails, strings.ToLower(email[1]))
+      }
+    }
+  }
+
+  return emails
+}
+
+// includes determines whether the user, or an email address of the trailers
+// they wrote which belongs to them, belongs to any of the maintainers.  Without
+// an identity mapping anyone could name a maintainer's address in a trailer, so
+// only logins are matched.
+func (m *maintainership) includes(maintainers []*maintainer, username string, emails []string) bool {
+  for _, entry := range maintainers {
+    if entry.login != "" && strings.EqualFold(entry.login, username) {
+      return true
+    }
+
+    if m.mapping == nil || entry.email == "" {
+      continue
+    }
+
+    for _, email := range emails {
+      if entry.email != email {
+        continue
+      }
+
+      if owned, _ := m.mapping.owns(username, email); owned {
+        return true
+      }
+    }
+  }
+
+  return false
+}
+
+// approver determines whether the author of the post maintains any of the
+// changed paths
+func (m *maintainership) approver(source *Source, p *post) bool {
+  return m.includes(
+    m.maintainers,
+    p.login(),
+    trailerEmails(source.ApproverComments, p.body),
+  )
+}
+
+// reviewer determines whether the author of the post reviews any of the
+// changed paths
+func (m *maintainership) reviewer(source *Source, p *post) bool {
+  return m.includes(
+    m.reviewers,
+    p.login(),
+    trailerEmails(source.ReviewerComments, p.body),
+  )
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "os"
+  "fmt"
+  "time"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// mergeabilityRetries is the number of times a pull request is requested again
+// whilst Github is still computing its mergeability
+var mergeabilityRetries = 3
+
+// mergeabilityDelay is the time to wait before requesting a pull request again
+var mergeabilityDelay = 2 * time.Second
+
+// mergeabilityBudget is the total time a check waits for the mergeability of
+// pull requests, after which any pull request still unknown is deferred right
+// away rather than holding up the check
+var mergeabilityBudget = 20 * time.Second
+
+// mergeabilityWaited is the time the current check has waited so far
+var mergeabilityWaited time.Duration
+
+// mergeabilityDeferral is how long after its last update a pull request whose
+// mergeability is unknown is deferred for
+var mergeabilityDeferral = time.Hour
+
+// requestsMergeability determines whether the mergeability of pull requests is
+// needed to select them
+func (source *Source) requestsMergeability() bool {
+  return source.OnlyMergeable || len(source.MergeableStates) > 0
+}
+
+// requestsMergeableState determines whether the mergeable state of the pull
+// request, e.g. `clean` or `behind`, is requested
+func (source *Source) requestsMergeableState(state string) bool {
+  if len(source.MergeableStates) == 0 {
+    return true
+  }
+
+  for _, s := range source.MergeableStates {
+    if strings.EqualFold(s, state) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// knowsMergeability determines whether Github has computed the mergeability of
+// the pull request.  It is computed lazily in the background, such that it is
+// unset when listing pull requests and for a short while after each push.
+func knowsMergeability(pull *github.PullRequest) bool {
+  return pull.Mergeable != nil &&
+         pull.GetMergeableState() != "" &&
+         pull.GetMergeableState() != "unknown"
+}
+
+// mirrorsDirectory is where bare mirrors of repositories are kept such that
+// they only need to be fetched incrementally by subsequent checks
+var mirrorsDirectory = filepath.Join(os.TempDir(), "github-pr-approval-mirrors")
+
+// localMergeability merges the head of the pull request into its base using a
+// bare mirror of the repository and returns whether it merges cleanly, and
+// otherwise the conflicting paths
+func (source *Source) localMergeability(pull *github.PullRequest) (bool, []string, error) {
+  git, err := api.NewGitClient(
+    source.AccessToken,
+    source.SkipSSLVerification,
+    source.DisableGitLfs,
+    filepath.Join(mirrorsDirectory, strings.Replace(source.Repository, "/", "_", -1)),
+    ioutil.Discard,
+  )
+  if err != nil {
+    return false, nil, fmt.Errorf("failed to initialize git client: %s", err)
+  }
+
+  base := fmt.Sprintf("refs/heads/%s", pull.GetBase().GetRef())
+  head := fmt.Sprintf("refs/pull/%d/head", pull.GetNumber())
+
+  if err := git.Mirror(pull.GetBase().GetRepo().GetCloneURL(), base, head); err != nil {
+    return false, nil, fmt.Errorf("failed to mirror repository: %s", err)
+  }
+
+  return git.MergeTree(base, head)
+}
+
+// selectsMergeability determines whether the pull request is selected by its
+// mergeability.  Pull requests are requested again until Github has computed
+// their mergeability, or if `local_mergeability` is set, it is computed locally
+// instead.  If it is still unknown, the pull request is deferred.
+func (source *Source) selectsMergeability(c api.Github, pull *github.PullRequest) (selected bool, deferred bool, err error) {
+  if !source.requestsMergeability() {
+    return true, false, nil
+  }
+
+  // Mergeability is never computed for closed pull requests
+  if pull.GetState() != "open" {
+    return false, false, nil
+  }
+
+  retries := mergeabilityRetries
+  if source.LocalMergeability {
+    retries = 0
+  }
+
+  for i := 0; !knowsMergeability(pull); i++ {
+    if i > retries {
+      return source.selectsLocalMergeability(pull)
+    }
+
+    // Requesting the pull request triggers the computation, so only wait when
+    // it has already been requested once
+    if i > 0 {
+      if mergeabilityWaited + mergeabilityDelay > mergeabilityBudget {
+        return source.selectsLocalMergeability(pull)
+      }
+
+      time.Sleep(mergeabilityDelay)
+      mergeabilityWaited += mergeabilityDelay
+    }
+
+    pull, err = c.GetPullRequest(pull.GetNumber())
+    if err != nil {
+      return false, false, err
+    }
+  }
+
+  if source.OnlyMergeable && !pull.GetMergeable() {
+    return false, false, nil
+  }
+
+  return source.requestsMergeableState(pull.GetMergeableState()), false, nil
+}
+
+// selectsLocalMergeability determines whether the pull request is selected by
+// its locally computed mergeability.  Only conflicts can be determined locally,
+// so a pull request which merges cleanly is taken to be in the `clean` state.
+// A pull request which cannot be merged locally, e.g. with an older version of
+// Git, is deferred rather than failing the whole check.
+func (source *Source) selectsLocalMergeability(pull *github.PullRequest) (selected bool, deferred bool, err error) {
+  if !source.LocalMergeability {
+    return source.defersMergeability(pull)
+  }
+
+  clean, _, err := source.localMergeability(pull)
+  if err != nil {
+    logger.Printf("Could not merge pull request #%d locally: %s", pull.GetNumber(), err)
+    return source.defersMergeability(pull)
+  }
+
+  if !clean {
+    return !source.OnlyMergeable && source.requestsMergeableState("dirty"), false, nil
+  }
+
+  return source.requestsMergeableState("clean"), false, nil
+}
+
+// defersMergeability determines whether the pull request, whose mergeability
+// could not be determined, is deferred.  It is only deferred for a while after
+// its last update, after which it is no longer selected such that it does not
+// hold back the versions of all other pull requests indefinitely.
+func (source *Source) defersMergeability(pull *github.PullRequest) (selected bool, deferred bool, err error) {
+  if now().Sub(pull.GetUpdatedAt()) < mergeabilityDeferral {
+    return false, true, nil
+  }
+
+  logger.Printf("Skipping pull request #%d: mergeability is still unknown", pull.GetNumber())
+
+  return false, false, nil
+}
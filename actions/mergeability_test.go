@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "time"
+  "testing"
+
+  "github.com/google/go-github/v32/github"
+)
+
+func TestSelectsMergeabilityDefers(t *testing.T) {
+  previous := mergeabilityDelay
+  mergeabilityDelay = 0
+  t.Cleanup(func() { mergeabilityDelay = previous })
+
+  at(t, time.Unix(10000, 0))
+  mergeabilityWaited = 0
+
+  // Github never computes the mergeability of either pull request
+  recent, stale := stubPull(1, 10000 - 60), stubPull(2, 10000 - 7200)
+  c := &stubGithub{pulls: []*github.PullRequest{recent, stale}}
+  source := &Source{MergeableStates: []string{"clean"}}
+
+  tests := []struct {
+    pull     *github.PullRequest
+    deferred bool
+  }{
+    {recent, true},
+    {stale, false},
+  }
+
+  for _, test := range tests {
+    selected, deferred, err := source.selectsMergeability(c, test.pull)
+    if err != nil {
+      t.Fatalf("selectsMergeability(#%d): %s", test.pull.GetNumber(), err)
+    }
+
+    if selected || deferred != test.deferred {
+      t.Errorf("selectsMergeability(#%d): expected deferred %t, got selected %t and deferred %t",
+        test.pull.GetNumber(), test.deferred, selected, deferred)
+    }
+  }
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "strings"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+  "github.com/unikraft/concourse-github-pr-approval-resource/policy"
+)
+
+// approvalPolicy parses the approval policy of the source, or returns nil if
+// none is set, and checks that every named group is defined
+func (source *Source) approvalPolicy() (*policy.Policy, error) {
+  if source.ApprovalPolicy == "" {
+    return nil, nil
+  }
+
+  p, err := policy.Parse(source.ApprovalPolicy)
+  if err != nil {
+    return nil, err
+  }
+
+  for _, group := range p.Groups() {
+    if group.Kind != policy.Named {
+      continue
+    }
+
+    refs, ok := source.ApprovalGroups[group.Name]
+    if !ok {
+      return nil, fmt.Errorf("unknown approval group: %s", group.Name)
+    }
+
+    for _, ref := range refs {
+      member, err := policy.ParseGroup(ref)
+      if err != nil {
+        return nil, fmt.Errorf("invalid approval group %s: %s", group.Name, err)
+      }
+
+      if member.Kind == policy.Named {
+        return nil, fmt.Errorf("invalid approval group %s: cannot contain %s", group.Name, ref)
+      }
+    }
+  }
+
+  return p, nil
+}
+
+// policyResolver resolves the groups named by the approval policy for a pull
+// request
+type policyResolver struct {
+  client   api.Github
+  source   *Source
+  pull     *github.PullRequest
+}
+
+// IsMember determines whether the user belongs to the group
+func (r *policyResolver) IsMember(login string, group policy.Group) (bool, error) {
+  switch group.Kind {
+  case policy.Team:
+    return r.client.UserMemberOfTeam(login, group.Name)
+
+  case policy.User:
+    return strings.EqualFold(group.Name, login), nil
+
+  case policy.Assignees:
+    for _, assignee := range r.pull.Assignees {
+      if strings.EqualFold(assignee.GetLogin(), login) {
+        return true, nil
+      }
+    }
+
+  case policy.RequestedReviewers:
+    return requestedReviewer(r.client, r.pull, login)
+
+  case policy.Anyone:
+    return true, nil
+
+  case policy.Named:
+    for _, ref := range r.source.ApprovalGroups[group.Name] {
+      member, err := policy.ParseGroup(ref)
+      if err != nil {
+        return false, err
+      }
+
+      if ok, err := r.IsMember(login, member); ok || err != nil {
+        return ok, err
+      }
+    }
+  }
+
+  return false, nil
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "encoding/json"
+
+  "sigs.k8s.io/yaml"
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// policyFile holds the approval rules set by the policy file in the repository
+type policyFile struct {
+  ApprovalRules
+  overrides []string
+}
+
+// policyFileCache holds the policy files which have been parsed by the SHA of
+// the base they were read from
+var policyFileCache = make(map[string]*policyFile)
+
+// parsePolicyFile parses the approval rules set by the policy file, which is
+// written in YAML or JSON
+func parsePolicyFile(data []byte) (*policyFile, error) {
+  f := &policyFile{}
+  if len(data) == 0 {
+    return f, nil
+  }
+
+  data, err := yaml.YAMLToJSON(data)
+  if err != nil {
+    return nil, fmt.Errorf("must be YAML or JSON: %s", err)
+  }
+
+  if err := json.Unmarshal(data, &f.ApprovalRules); err != nil {
+    return nil, err
+  }
+
+  f.overrides, err = ruleNames(data)
+  if err != nil {
+    return nil, err
+  }
+
+  return f, nil
+}
+
+// allowsPolicyField determines whether the policy file may override the named
+// approval rule, which are all of them unless restricted by the source
+func (source *Source) allowsPolicyField(name string) bool {
+  if len(source.PolicyFields) == 0 {
+    return true
+  }
+
+  for _, field := range source.PolicyFields {
+    if field == name {
+      return true
+    }
+  }
+
+  return false
+}
+
+// validatePolicyFields checks that every field the policy file is allowed to
+// override is an approval rule
+func (source *Source) validatePolicyFields() error {
+  for _, field := range source.PolicyFields {
+    if _, ok := ruleField(field); !ok {
+      return fmt.Errorf("invalid policy field: %s", field)
+    }
+  }
+
+  return nil
+}
+
+// withPolicyFile returns the source with the approval rules set by the policy
+// file on the base of the pull request, as far as the source allows them to
+// be overridden.  Disallowed rules are ignored, and the source is returned as
+// is if the base has no policy file.
+func (source Source) withPolicyFile(client api.Github, pull *github.PullRequest) (Source, error) {
+  if err := source.validatePolicyFields(); err != nil {
+    return source, err
+  }
+
+  sha := pull.GetBase().GetSHA()
+
+  f, ok := policyFileCache[sha]
+  if !ok {
+    data, err := client.GetFileContents(source.PolicyPath, sha)
+    if err != nil {
+      return source, fmt.Errorf("could not retrieve %s: %s", source.PolicyPath, err)
+    }
+
+    f, err = parsePolicyFile(data)
+    if err != nil {
+      return source, fmt.Errorf("could not parse %s: %s", source.PolicyPath, err)
+    }
+
+    var allowed []string
+    for _, name := range f.overrides {
+      if !source.allowsPolicyField(name) {
+        logger.Printf("Ignoring %s in %s at %s: not allowed", name, source.PolicyPath, sha)
+        continue
+      }
+
+      allowed = append(allowed, name)
+    }
+
+    f.overrides = allowed
+    policyFileCache[sha] = f
+  }
+
+  source.ApprovalRules.override(&f.ApprovalRules, f.overrides)
+
+  return source, nil
+}
@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "path"
+  "sort"
+  "regexp"
+  "reflect"
+  "encoding/json"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// Profile overrides the approval rules of the source for the pull requests it
+// matches by base branch, labels or changed paths.  Only the rules which are
+// set by the profile are overridden.
+type Profile struct {
+  Name           string `json:"name"`
+  BaseBranches []string `json:"base_branches"`
+  Labels       []string `json:"labels"`
+  Paths        []string `json:"paths"`
+
+  ApprovalRules
+  overrides    []string
+  paths        []*regexp.Regexp
+}
+
+// ruleField returns the index of the approval rule with the given JSON name
+func ruleField(name string) (int, bool) {
+  t := reflect.TypeOf(ApprovalRules{})
+  for i := 0; i < t.NumField(); i++ {
+    if t.Field(i).Tag.Get("json") == name {
+      return i, true
+    }
+  }
+
+  return 0, false
+}
+
+// ruleNames returns the JSON names of the approval rules set by the object,
+// which must not set anything else but the given fields
+func ruleNames(b []byte, fields ...string) ([]string, error) {
+  var object map[string]json.RawMessage
+  if err := json.Unmarshal(b, &object); err != nil {
+    return nil, err
+  }
+
+  var names []string
+
+  nextField:
+  for name := range object {
+    for _, field := range fields {
+      if name == field {
+        continue nextField
+      }
+    }
+
+    if _, ok := ruleField(name); !ok {
+      return nil, fmt.Errorf("unknown rule %s", name)
+    }
+
+    names = append(names, name)
+  }
+
+  sort.Strings(names)
+
+  return names, nil
+}
+
+// override sets the named approval rules to those of the given rules
+func (rules *ApprovalRules) override(from *ApprovalRules, names []string) {
+  dst := reflect.ValueOf(rules).Elem()
+  src := reflect.ValueOf(from).Elem()
+
+  for _, name := range names {
+    if i, ok := ruleField(name); ok {
+      dst.Field(i).Set(src.Field(i))
+    }
+  }
+}
+
+// UnmarshalJSON decodes the profile, recording which approval rules it sets
+func (p *Profile) UnmarshalJSON(b []byte) error {
+  type profile Profile
+  if err := json.Unmarshal(b, (*profile)(p)); err != nil {
+    return err
+  }
+
+  if p.Name == "" {
+    return fmt.Errorf("invalid profile: no name")
+  }
+
+  var err error
+  p.overrides, err = ruleNames(b, "name", "base_branches", "labels", "paths")
+  if err != nil {
+    return fmt.Errorf("invalid profile %s: %s", p.Name, err)
+  }
+
+  for _, glob := range p.Paths {
+    re, err := globRegexp(glob, false)
+    if err != nil {
+      return fmt.Errorf("invalid profile %s: %s", p.Name, err)
+    }
+
+    p.paths = append(p.paths, re)
+  }
+
+  return nil
+}
+
+// matches determines whether the pull request is against any of the base
+// branches, carries any of the labels and only changes the paths of the
+// profile, where each condition which is not set matches all pull requests
+func (p *Profile) matches(client api.Github, pull *github.PullRequest) (bool, error) {
+  if len(p.BaseBranches) > 0 {
+    matched := false
+    for _, glob := range p.BaseBranches {
+      if ok, _ := path.Match(glob, pull.GetBase().GetRef()); ok {
+        matched = true
+        break
+      }
+    }
+
+    if !matched {
+      return false, nil
+    }
+  }
+
+  if len(p.Labels) > 0 {
+    matched := false
+    for _, label := range pull.Labels {
+      for _, l := range p.Labels {
+        if l == label.GetName() {
+          matched = true
+        }
+      }
+    }
+
+    if !matched {
+      return false, nil
+    }
+  }
+
+  if len(p.paths) == 0 {
+    return true, nil
+  }
+
+  files, err := client.ListPullRequestFiles(*pull.Number)
+  if err != nil {
+    return false, fmt.Errorf("could not retrieve changed files: %s", err)
+  }
+
+  for _, file := range files {
+    matched := false
+    for _, re := range p.paths {
+      if re.MatchString(file) {
+        matched = true
+        break
+      }
+    }
+
+    if !matched {
+      return false, nil
+    }
+  }
+
+  return len(files) > 0, nil
+}
+
+// withProfile returns the source with the approval rules of the given profile
+func (source Source) withProfile(p *Profile) Source {
+  source.ApprovalRules.override(&p.ApprovalRules, p.overrides)
+  return source
+}
+
+// forPullRequest returns the source with the approval rules of the policy file
+// on the base of the pull request and then of the first profile which matches
+// the pull request applied, as well as the name of that profile, or an empty
+// name if none matches
+func (source Source) forPullRequest(client api.Github, pull *github.PullRequest) (Source, string, error) {
+  if source.PolicyPath != "" {
+    var err error
+    source, err = source.withPolicyFile(client, pull)
+    if err != nil {
+      return source, "", err
+    }
+  }
+
+  for i := range source.Profiles {
+    p := &source.Profiles[i]
+
+    matched, err := p.matches(client, pull)
+    if err != nil {
+      return source, "", err
+    }
+
+    if matched {
+      return source.withProfile(p), p.Name, nil
+    }
+  }
+
+  return source, "", nil
+}
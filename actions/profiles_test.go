@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "testing"
+  "encoding/json"
+
+  "github.com/google/go-github/v32/github"
+)
+
+// profileGithub additionally serves the changed files of pull requests and the
+// permissions of users
+type profileGithub struct {
+  *stubGithub
+  files       map[int][]string
+  permissions map[string]string
+}
+
+func (c *profileGithub) ListPullRequestFiles(prID int) ([]string, error) {
+  return c.files[prID], nil
+}
+
+func (c *profileGithub) GetCollaboratorPermission(username string) (string, error) {
+  return c.permissions[username], nil
+}
+
+// profileSource is the source of the profiles example
+const profileSource = `{
+  "repository": "unikraft/unikraft",
+  "approver_comments": ["Approved-by: .*"],
+  "approver_teams": ["@unikraft/maintainers"],
+  "reviewer_comments": ["Reviewed-by: .*"],
+  "reviewer_teams": ["@unikraft/reviewers"],
+  "min_approvals": 1,
+  "profiles": [{
+    "name": "stable",
+    "base_branches": ["stable*"],
+    "min_approvals": 2,
+    "reviewer_teams": ["@unikraft/release-managers"]
+  }, {
+    "name": "docs",
+    "paths": ["docs/", "*.md"],
+    "approver_teams": [],
+    "approver_permissions": ["write", "maintain", "admin"],
+    "approval_policy": "1 of anyone"
+  }]
+}`
+
+func TestForPullRequest(t *testing.T) {
+  var source Source
+  if err := json.Unmarshal([]byte(profileSource), &source); err != nil {
+    t.Fatalf("could not unmarshal source: %s", err)
+  }
+
+  stable, docs, other := stubPull(1, 1000), stubPull(2, 1000), stubPull(3, 1000)
+  stable.Base.Ref = github.String("stable-0.5")
+
+  c := &profileGithub{
+    stubGithub: &stubGithub{},
+    files: map[int][]string{
+      1: {"lib/a.c", "README.md"},
+      2: {"docs/guide.md", "README.md"},
+      3: {"lib/a.c", "README.md"},
+    },
+  }
+
+  tests := []struct {
+    pull          *github.PullRequest
+    profile       string
+    minApprovals  int
+    approverTeams int
+    reviewerTeam  string
+    policy        string
+  }{
+    {stable, "stable", 2, 1, "@unikraft/release-managers", ""},
+    {docs, "docs", 1, 0, "@unikraft/reviewers", "1 of anyone"},
+    {other, "", 1, 1, "@unikraft/reviewers", ""},
+  }
+
+  for _, test := range tests {
+    profiled, name, err := source.forPullRequest(c, test.pull)
+    if err != nil {
+      t.Fatalf("forPullRequest(#%d): %s", test.pull.GetNumber(), err)
+    }
+
+    if name != test.profile ||
+       profiled.MinApprovals != test.minApprovals ||
+       len(profiled.ApproverTeams) != test.approverTeams ||
+       profiled.ReviewerTeams[0] != test.reviewerTeam ||
+       profiled.ApprovalPolicy != test.policy {
+      t.Errorf("forPullRequest(#%d): unexpected profile %q with %+v",
+        test.pull.GetNumber(), name, profiled.ApprovalRules)
+    }
+  }
+
+  // The source itself is left as is
+  if source.MinApprovals != 1 || len(source.ApproverTeams) != 1 {
+    t.Errorf("forPullRequest: source was modified: %+v", source.ApprovalRules)
+  }
+}
+
+func TestProfileSatisfiable(t *testing.T) {
+  var source Source
+  if err := json.Unmarshal([]byte(profileSource), &source); err != nil {
+    t.Fatalf("could not unmarshal source: %s", err)
+  }
+
+  tests := []struct {
+    login     string
+    satisfied bool
+  }{
+    {"dave", true},
+    {"erin", false},
+  }
+
+  for _, test := range tests {
+    docs := stubPull(2, 1000)
+    c := &profileGithub{
+      stubGithub: &stubGithub{
+        comments: map[int][]*github.IssueComment{
+          2: {stubComment(21, 4, test.login, "Approved-by: Someone <someone@example.com>", 900)},
+        },
+      },
+      files:       map[int][]string{2: {"docs/guide.md"}},
+      permissions: map[string]string{"dave": "write", "erin": "read"},
+    }
+
+    profiled, _, err := source.forPullRequest(c, docs)
+    if err != nil {
+      t.Fatalf("forPullRequest: %s", err)
+    }
+
+    version, err := evaluatePullRequest(c, profiled, docs)
+    if err != nil {
+      t.Fatalf("evaluatePullRequest: %s", err)
+    }
+
+    if profiled.satisfiedBy(version) != test.satisfied {
+      t.Errorf("satisfiedBy: expected an approval by %s to satisfy the docs profile: %t",
+        test.login, test.satisfied)
+    }
+  }
+}
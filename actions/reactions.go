@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// ReactionRule selects the reactions which approve a pull request by their
+// content, e.g. `+1` or `rocket`, and their target, which is either the
+// description of the pull request or its comments matching a regex
+type ReactionRule struct {
+  Content      string `json:"content"`
+  Target       string `json:"target"`
+  CommentRegex string `json:"comment_regex"`
+}
+
+// reactionPost converts the reaction into a post.  Reactions to a comment
+// refer to it, such that the reaction can be retrieved again.
+func reactionPost(reaction *api.Reaction, commentID int64) *post {
+  p := &post{
+    nodeID:   reaction.NodeID,
+    user:     reaction.User,
+    state:    "reaction",
+    at:       reaction.CreatedAt,
+    response: &Response{
+      CreatedAt:  strconv.FormatInt(reaction.CreatedAt.Unix(), 10),
+      ReactionID: strconv.FormatInt(reaction.ID, 10),
+    },
+  }
+
+  if commentID > 0 {
+    p.response.CommentID = strconv.FormatInt(commentID, 10)
+  }
+
+  return p
+}
+
+// isReaction determines whether the post is a reaction
+func (p *post) isReaction() bool {
+  return p.response.ReactionID != ""
+}
+
+// reactionPosts gathers the reactions to the pull request and its comments
+// which approve it according to the rules of the source
+func (source *Source) reactionPosts(c api.Github, pull *github.PullRequest, comments []*github.IssueComment) ([]*post, error) {
+  var posts []*post
+  seen := make(map[int64]bool)
+
+  add := func(reactions []*api.Reaction, rule ReactionRule, commentID int64) {
+    for _, reaction := range reactions {
+      if reaction.Content != rule.Content || seen[reaction.ID] {
+        continue
+      }
+
+      seen[reaction.ID] = true
+      posts = append(posts, reactionPost(reaction, commentID))
+    }
+  }
+
+  for _, rule := range source.ApproverReactions {
+    switch rule.Target {
+    case "body", "":
+      reactions, err := c.ListPullRequestReactions(pull.GetNumber())
+      if err != nil {
+        return nil, fmt.Errorf("could not retrieve reactions: %s", err)
+      }
+
+      add(reactions, rule, 0)
+
+    case "comments":
+      re, err := regexp.Compile(rule.CommentRegex)
+      if err != nil {
+        return nil, fmt.Errorf("invalid comment regex: %s", err)
+      }
+
+      for _, comment := range comments {
+        if !re.MatchString(comment.GetBody()) {
+          continue
+        }
+
+        reactions, err := c.ListCommentReactions(comment.GetID())
+        if err != nil {
+          return nil, fmt.Errorf("could not retrieve reactions: %s", err)
+        }
+
+        add(reactions, rule, comment.GetID())
+      }
+
+    default:
+      return nil, fmt.Errorf("invalid reaction target: %s", rule.Target)
+    }
+  }
+
+  return posts, nil
+}
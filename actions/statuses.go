@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "time"
+  "regexp"
+
+  "github.com/google/go-github/v32/github"
+
+  "github.com/unikraft/concourse-github-pr-approval-resource/api"
+)
+
+// Status summarises a commit status or check run required by the source
+type Status struct {
+  Required  string    `json:"required"`
+  Type      string    `json:"type"`
+  Name      string    `json:"name"`
+  State     string    `json:"state"`
+  URL       string    `json:"url"`
+  UpdatedAt time.Time `json:"updated_at"`
+}
+
+// passed determines whether the status or check run was successful
+func (s *Status) passed() bool {
+  return s.State == "success"
+}
+
+// matchesContext determines whether the name of a status or check run is the
+// required one, either by name or by regular expression
+func matchesContext(required, name string) bool {
+  if required == name {
+    return true
+  }
+
+  matched, _ := regexp.MatchString("^(?:" + required + ")$", name)
+  return matched
+}
+
+// checkRunState converts the state of the check run into that of a status.
+// Neutral and skipped check runs are considered successful, as done by Github.
+func checkRunState(run *github.CheckRun) string {
+  if run.GetStatus() != "completed" {
+    return "pending"
+  }
+
+  switch run.GetConclusion() {
+  case "success", "neutral", "skipped":
+    return "success"
+  }
+
+  return "failure"
+}
+
+// requiredStatuses evaluates the statuses and check runs required by the
+// source against the head of the pull request.  Each requirement which is not
+// met by any status or check run is reported as missing.
+func (source *Source) requiredStatuses(client api.Github, pull *github.PullRequest) ([]*Status, error) {
+  var summary []*Status
+
+  if len(source.RequiredStatuses) > 0 {
+    statuses, err := client.ListStatuses(pull.GetHead().GetSHA())
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve statuses: %s", err)
+    }
+
+    for _, required := range source.RequiredStatuses {
+      found := false
+
+      for _, status := range statuses {
+        if !matchesContext(required, status.GetContext()) {
+          continue
+        }
+
+        found = true
+        summary = append(summary, &Status{
+          Required:  required,
+          Type:      "status",
+          Name:      status.GetContext(),
+          State:     status.GetState(),
+          URL:       status.GetTargetURL(),
+          UpdatedAt: status.GetUpdatedAt(),
+        })
+      }
+
+      if !found {
+        summary = append(summary, &Status{
+          Required: required,
+          Type:     "status",
+          State:    "missing",
+        })
+      }
+    }
+  }
+
+  if len(source.RequiredCheckRuns) > 0 {
+    runs, err := client.ListCheckRuns(pull.GetHead().GetSHA())
+    if err != nil {
+      return nil, fmt.Errorf("could not retrieve check runs: %s", err)
+    }
+
+    for _, required := range source.RequiredCheckRuns {
+      found := false
+
+      for _, run := range runs {
+        if !matchesContext(required, run.GetName()) {
+          continue
+        }
+
+        found = true
+        summary = append(summary, &Status{
+          Required:  required,
+          Type:      "check_run",
+          Name:      run.GetName(),
+          State:     checkRunState(run),
+          URL:       run.GetHTMLURL(),
+          UpdatedAt: run.GetCompletedAt().Time,
+        })
+      }
+
+      if !found {
+        summary = append(summary, &Status{
+          Required: required,
+          Type:     "check_run",
+          State:    "missing",
+        })
+      }
+    }
+  }
+
+  return summary, nil
+}
+
+// statusesState returns the combined state of the statuses, which is only
+// successful if all of them are
+func statusesState(statuses []*Status) string {
+  for _, status := range statuses {
+    if status.State == "failure" || status.State == "error" {
+      return "failure"
+    }
+  }
+
+  for _, status := range statuses {
+    if !status.passed() {
+      return "pending"
+    }
+  }
+
+  return "success"
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "fmt"
+  "time"
+  "regexp"
+  "strconv"
+  "encoding/json"
+
+  "github.com/google/go-github/v32/github"
+)
+
+// now returns the current time and may be replaced to evaluate pull requests
+// at a different point in time
+var now = time.Now
+
+// durationDays matches a leading number of days which is not supported by
+// time.ParseDuration, e.g. `30d` or `1d12h`
+var durationDays = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// Duration is a period of time given as a string, e.g. `48h` or `30d`
+type Duration time.Duration
+
+// UnmarshalJSON decodes a duration given in days or as parsed by
+// time.ParseDuration
+func (d *Duration) UnmarshalJSON(b []byte) error {
+  var s string
+  if err := json.Unmarshal(b, &s); err != nil {
+    return fmt.Errorf("invalid duration: %s", b)
+  }
+
+  var days time.Duration
+  if match := durationDays.FindStringSubmatch(s); match != nil {
+    n, err := strconv.Atoi(match[1])
+    if err != nil {
+      return fmt.Errorf("invalid duration: %s", s)
+    }
+
+    days = time.Duration(n) * 24 * time.Hour
+    s = match[2]
+  }
+
+  var rest time.Duration
+  if s != "" {
+    var err error
+    rest, err = time.ParseDuration(s)
+    if err != nil {
+      return fmt.Errorf("invalid duration: %s", err)
+    }
+  }
+
+  *d = Duration(days + rest)
+
+  return nil
+}
+
+// requestsAges determines whether the age of pull requests or approvals is
+// part of the desired state
+func (source *Source) requestsAges() bool {
+  return source.MinPRAge > 0 ||
+         source.ApprovalCooldown > 0 ||
+         source.ApprovalMaxAge > 0
+}
+
+// lookback returns how long before the cursor a pull request may have last
+// been updated and still only meet the desired state after the cursor, since
+// it and its approvals must first come of age
+func (source *Source) lookback() time.Duration {
+  lookback := time.Duration(source.MinPRAge)
+  if cooldown := time.Duration(source.ApprovalCooldown); cooldown > lookback {
+    lookback = cooldown
+  }
+
+  return lookback
+}
+
+// approvalAgeReason returns why the approval does not count at the current
+// time, or an empty string if it does
+func (source *Source) approvalAgeReason(p *post) string {
+  age := now().Sub(p.at)
+
+  if cooldown := time.Duration(source.ApprovalCooldown); age < cooldown {
+    return fmt.Sprintf(
+      "cooling down: counts from %s",
+      p.at.Add(cooldown).Format(time.RFC3339),
+    )
+  }
+
+  if maxAge := time.Duration(source.ApprovalMaxAge); maxAge > 0 && age > maxAge {
+    return fmt.Sprintf(
+      "expired: posted more than %s ago",
+      maxAge,
+    )
+  }
+
+  return ""
+}
+
+// openedLongEnough determines whether the pull request has been open for the
+// minimum age and returns the time from which it has been
+func (source *Source) openedLongEnough(pull *github.PullRequest) (bool, time.Time) {
+  since := pull.GetCreatedAt().Add(time.Duration(source.MinPRAge))
+  return !now().Before(since), since
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package actions
+
+import (
+  "time"
+  "testing"
+  "encoding/json"
+
+  "github.com/google/go-github/v32/github"
+)
+
+// at fixes the current time for the duration of a test
+func at(t *testing.T, current time.Time) {
+  previous := now
+  now = func() time.Time { return current }
+  t.Cleanup(func() { now = previous })
+}
+
+func TestDurationUnmarshal(t *testing.T) {
+  tests := []struct {
+    in   string
+    want time.Duration
+    err  bool
+  }{
+    {`"48h"`, 48 * time.Hour, false},
+    {`"30d"`, 30 * 24 * time.Hour, false},
+    {`"1d12h"`, 36 * time.Hour, false},
+    {`"90m"`, 90 * time.Minute, false},
+    {`"1w"`, 0, true},
+    {`48`, 0, true},
+  }
+
+  for _, test := range tests {
+    var d Duration
+    err := json.Unmarshal([]byte(test.in), &d)
+    if test.err {
+      if err == nil {
+        t.Errorf("Duration(%s): expected error", test.in)
+      }
+      continue
+    }
+
+    if err != nil {
+      t.Errorf("Duration(%s): %s", test.in, err)
+      continue
+    }
+
+    if time.Duration(d) != test.want {
+      t.Errorf("Duration(%s): expected %s, got %s", test.in, test.want, time.Duration(d))
+    }
+  }
+}
+
+func TestApprovalAgeReason(t *testing.T) {
+  posted := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+  source := &Source{}
+  source.ApprovalCooldown = Duration(time.Hour)
+  source.ApprovalMaxAge = Duration(7 * 24 * time.Hour)
+
+  tests := []struct {
+    current time.Time
+    reason  string
+  }{
+    {posted.Add(30 * time.Minute), "cooling down: counts from 2021-01-01T13:00:00Z"},
+    {posted.Add(time.Hour), ""},
+    {posted.Add(7 * 24 * time.Hour), ""},
+    {posted.Add(8 * 24 * time.Hour), "expired: posted more than 168h0m0s ago"},
+  }
+
+  for _, test := range tests {
+    at(t, test.current)
+
+    reason := source.approvalAgeReason(&post{at: posted})
+    if reason != test.reason {
+      t.Errorf("approvalAgeReason at %s: expected %q, got %q", test.current, test.reason, reason)
+    }
+  }
+}
+
+func TestOpenedLongEnough(t *testing.T) {
+  created := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+  pull := &github.PullRequest{CreatedAt: &created}
+  source := &Source{MinPRAge: Duration(24 * time.Hour)}
+
+  at(t, created.Add(23 * time.Hour))
+  if ok, since := source.openedLongEnough(pull); ok || !since.Equal(created.Add(24 * time.Hour)) {
+    t.Errorf("openedLongEnough: expected not yet from %s, got %t from %s", created.Add(24 * time.Hour), ok, since)
+  }
+
+  at(t, created.Add(24 * time.Hour))
+  if ok, _ := source.openedLongEnough(pull); !ok {
+    t.Errorf("openedLongEnough: expected to be open long enough after a day")
+  }
+}
@@ -22,6 +22,7 @@
 package api
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -45,6 +46,8 @@ type Git interface {
 	Merge(string, bool) error
 	Rebase(string, string, bool) error
 	GitCryptUnlock(string) error
+	Mirror(string, ...string) error
+	MergeTree(string, string) (bool, []string, error)
 }
 
 // NewGitClient ...
@@ -245,6 +248,68 @@ func (g *GitClient) GitCryptUnlock(base64key string) error {
 	return nil
 }
 
+// Mirror initializes a bare repository in the directory, unless it exists
+// already, and fetches the given refs into it under the same name.
+func (g *GitClient) Mirror(uri string, refs ...string) error {
+	if _, err := os.Stat(filepath.Join(g.Directory, "HEAD")); os.IsNotExist(err) {
+		if err := os.MkdirAll(g.Directory, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to create mirror directory: %s", err)
+		}
+		if err := g.command("git", "init", "--bare").Run(); err != nil {
+			return fmt.Errorf("init failed: %s", err)
+		}
+	}
+
+	endpoint, err := g.Endpoint(uri)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"fetch", "--force", "--no-tags", endpoint}
+	for _, ref := range refs {
+		args = append(args, fmt.Sprintf("+%s:%s", ref, ref))
+	}
+	cmd := g.command("git", args...)
+
+	// Discard output to have zero chance of logging the access token.
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = ioutil.Discard
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("fetch failed: %s", err)
+	}
+	return nil
+}
+
+// MergeTree merges the head into the base without a worktree and returns
+// whether it merges cleanly, and otherwise the conflicting paths.  This
+// requires Git 2.38 or later.
+func (g *GitClient) MergeTree(base, head string) (bool, []string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "merge-tree", "--write-tree", "--name-only", "--no-messages", base, head)
+	cmd.Dir = g.Directory
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+
+	// An exit status of 1 signifies conflicts, any other is a failure
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		if err != nil {
+			return false, nil, fmt.Errorf("merge-tree '%s' '%s' failed: %s: %s", base, head, err, stderr.String())
+		}
+	}
+
+	// The first line is the resulting tree, followed by the conflicting paths
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	var conflicts []string
+	for _, line := range lines[1:] {
+		if line != "" {
+			conflicts = append(conflicts, line)
+		}
+	}
+
+	return err == nil, conflicts, nil
+}
+
 // Endpoint takes an uri and produces an endpoint with the login information baked in.
 func (g *GitClient) Endpoint(uri string) (string, error) {
 	endpoint, err := url.Parse(uri)
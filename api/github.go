@@ -32,6 +32,7 @@ package api
 
 import (
   "fmt"
+  "time"
   "context"
   "strconv"
   "strings"
@@ -49,16 +50,30 @@ type GithubClient struct {
   Owner      string
   Repository string
   Client     *github.Client
+  GraphQL    *GraphQLClient
 }
 
 // Github interface representing the desired functions for this resource.
 type Github interface {
-  ListPullRequests() ([]*github.PullRequest, error)
+  ListPullRequests(states []string, since time.Time) ([]*github.PullRequest, error)
   GetPullRequest(prID int) (*github.PullRequest, error)
   ListPullRequestComments(prID int) ([]*github.IssueComment, error)
   ListPullRequestReviews(prID int) ([]*github.PullRequestReview, error)
+  ListPullRequestReviewComments(prID int) ([]*github.PullRequestComment, error)
   GetPullRequestComment(commentID int64) (*github.IssueComment, error)
   GetPullRequestReview(prID int, reviewID int64) (*github.PullRequestReview, error)
+  GetPullRequestReviewComment(commentID int64) (*github.PullRequestComment, error)
+  ListContentEdits(nodeID string) ([]*ContentEdit, error)
+  ListReviewThreads(prID int) ([]*ReviewThread, error)
+  ListPullRequestTimeline(prID int) ([]*TimelineEvent, error)
+  ListPullRequestReactions(prID int) ([]*Reaction, error)
+  ListCommentReactions(commentID int64) ([]*Reaction, error)
+  ListPullRequestCommits(prID int) ([]*github.RepositoryCommit, error)
+  ListPullRequestFiles(prID int) ([]string, error)
+  GetFileContents(path, ref string) ([]byte, error)
+  ListStatuses(ref string) ([]*github.RepoStatus, error)
+  ListCheckRuns(ref string) ([]*github.CheckRun, error)
+  ListCheckSuites(ref string) ([]*CheckSuite, error)
   SetPullRequestState(prID int, state string) error
   DeleteLastPullRequestComment(prID int) error
   AddPullRequestLabels(prID int, labels []string) error
@@ -68,12 +83,80 @@ type Github interface {
   FindTeam(orgTeam string) (*github.Team, error)
   ListTeamMembers(orgTeam string) ([]string, error)
   UserMemberOfTeam(username, team string) (bool, error)
+  ListUserEmails(username string) ([]string, error)
+  ListUserCommitEmails(username string) ([]string, error)
+  GetCollaboratorPermission(username string) (string, error)
+}
+
+// TimelineEvent represents an event on the timeline of a pull request.  Only
+// the fields used by this resource are decoded.
+type TimelineEvent struct {
+  ID                int64                `json:"id,omitempty"`
+  Event             string               `json:"event"`
+  CreatedAt         *time.Time           `json:"created_at,omitempty"`
+  Actor             *github.User         `json:"actor,omitempty"`
+
+  // Populated for "committed" events
+  SHA               string               `json:"sha,omitempty"`
+  Author            *github.CommitAuthor `json:"author,omitempty"`
+  Committer         *github.CommitAuthor `json:"committer,omitempty"`
+
+  // Populated for "review_requested" and "review_request_removed" events
+  RequestedReviewer *github.User         `json:"requested_reviewer,omitempty"`
+  RequestedTeam     *github.Team         `json:"requested_team,omitempty"`
+}
+
+// ReviewThread represents a conversation on the diff of a pull request, as
+// started by its first comment
+type ReviewThread struct {
+  Path      string       `json:"path"`
+  Line      int          `json:"line,omitempty"`
+  Resolved  bool         `json:"resolved"`
+  Outdated  bool         `json:"outdated"`
+  URL       string       `json:"url"`
+  User      *github.User `json:"-"`
+  UserLogin string       `json:"user_login"`
+  CreatedAt time.Time    `json:"created_at"`
+  UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Reaction represents a reaction to a pull request or one of its comments,
+// including when it was created which go-github does not decode
+type Reaction struct {
+  ID        int64        `json:"id"`
+  NodeID    string       `json:"node_id"`
+  Content   string       `json:"content"`
+  User      *github.User `json:"user,omitempty"`
+  CreatedAt time.Time    `json:"created_at"`
+}
+
+// CheckSuite represents a check suite for a commit, including when it was
+// created which go-github does not decode
+type CheckSuite struct {
+  ID        int64       `json:"id"`
+  HeadSHA   string      `json:"head_sha"`
+  App       *github.App `json:"app,omitempty"`
+  CreatedAt time.Time   `json:"created_at"`
+}
+
+// ContentEdit is a revision of the body of a comment or review, as recorded by
+// its edit history
+type ContentEdit struct {
+  Editor   string    `json:"editor"`
+  EditedAt time.Time `json:"edited_at"`
+  Body     string    `json:"body"`
+  Deleted  bool      `json:"deleted"`
 }
 
 // Some local cache which helps us keep track of users and the teams they're
 // associated with.
 var (
-  userTeamCache map[string][]string
+  teamMembersCache  map[string]map[string]bool
+  contentsCache     map[string][]byte
+  userEmailsCache   map[string][]string
+  commitEmailsCache map[string][]string
+  permissionCache   map[string]string
+  timelineCache     map[int][]*TimelineEvent
 )
 
 // NewGitHubClient for creating a new instance of the client.
@@ -120,28 +203,51 @@ func NewGithubClient(repo string, accessToken string, skipSSL bool, githubEndpoi
     client = github.NewClient(oauth2Client)
   }
 
-  userTeamCache = make(map[string][]string)
+  graphqlEndpoint, err := parseGraphQLEndpoint(githubEndpoint)
+  if err != nil {
+    return nil, fmt.Errorf("failed to parse v4 endpoint: %s", err)
+  }
+
+  teamMembersCache = make(map[string]map[string]bool)
+  contentsCache = make(map[string][]byte)
+  userEmailsCache = make(map[string][]string)
+  commitEmailsCache = make(map[string][]string)
+  permissionCache = make(map[string]string)
+  timelineCache = make(map[int][]*TimelineEvent)
 
   return &GithubClient{
     Owner:      owner,
     Repository: repository,
     Client:     client,
+    GraphQL:    &GraphQLClient{
+      Endpoint: graphqlEndpoint,
+      Client:   oauth2Client,
+    },
   }, nil
 }
 
 // ListPullRequests returns the list of pull requests for the configured repo
-func (c *GithubClient) ListPullRequests() ([]*github.PullRequest, error) {
+// in the given states, most recently updated first.  Paging stops as soon as a
+// pull request which has not been updated since the provided time is found.
+func (c *GithubClient) ListPullRequests(states []string, since time.Time) ([]*github.PullRequest, error) {
   var pulls []*github.PullRequest
 	opts := github.ListOptions{}
 
+  // Only a single state or all states can be requested from the API
+  state := "all"
+  if len(states) == 1 {
+    state = states[0]
+  }
+
   for {
     more, resp, err := c.Client.PullRequests.List(
       context.TODO(),
       c.Owner,
       c.Repository,
       &github.PullRequestListOptions{
-        // We want all states so we can sort through them later
-        State: "all",
+        State:       state,
+        Sort:        "updated",
+        Direction:   "desc",
         ListOptions: opts,
       },
     )
@@ -150,6 +256,10 @@ func (c *GithubClient) ListPullRequests() ([]*github.PullRequest, error) {
     }
 
     for _, pull := range more {
+      if pull.GetUpdatedAt().Before(since) {
+        return pulls, nil
+      }
+
       pulls = append(pulls, pull)
     }
 
@@ -240,37 +350,405 @@ func (c *GithubClient) ListPullRequestReviews(prID int) ([]*github.PullRequestRe
   return reviews, nil
 }
 
-// GetPulLRequestComment returns the specific comment given its unique Github ID
+// ListPullRequestReviewComments returns the list of inline comments on the diff
+// of the specific pull request given its ID relative to the configured repo,
+// including replies in review threads
+func (c *GithubClient) ListPullRequestReviewComments(prID int) ([]*github.PullRequestComment, error) {
+  opts := github.ListOptions{
+    PerPage: 100,
+  }
+  var comments []*github.PullRequestComment
+
+  for {
+    more, resp, err := c.Client.PullRequests.ListComments(
+      context.TODO(),
+      c.Owner,
+      c.Repository,
+      prID,
+      &github.PullRequestListCommentsOptions{
+        ListOptions: opts,
+      },
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    comments = append(comments, more...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return comments, nil
+}
+
+// GetPulLRequestComment returns the specific comment given its unique Github ID,
+// or nil if it has been deleted
 func (c *GithubClient) GetPullRequestComment(commentID int64) (*github.IssueComment, error) {
-  comment, _, err := c.Client.Issues.GetComment(
+  comment, resp, err := c.Client.Issues.GetComment(
     context.TODO(),
     c.Owner,
     c.Repository,
     commentID,
   )
-  if err != nil {
+  if resp != nil && resp.StatusCode == http.StatusNotFound {
+    return nil, nil
+  } else if err != nil {
     return nil, err
   }
   
   return comment, nil
 }
 
-// GetPulLRequestReview returns the specific review given its unique Github ID
+// GetPulLRequestReview returns the specific review given its unique Github ID,
+// or nil if it has been deleted
 func (c *GithubClient) GetPullRequestReview(prID int, reviewID int64) (*github.PullRequestReview, error) {
-  review, _, err := c.Client.PullRequests.GetReview(
+  review, resp, err := c.Client.PullRequests.GetReview(
     context.TODO(),
     c.Owner,
     c.Repository,
     prID,
     reviewID,
   )
-  if err != nil {
+  if resp != nil && resp.StatusCode == http.StatusNotFound {
+    return nil, nil
+  } else if err != nil {
     return nil, err
   }
   
   return review, nil
 }
 
+// GetPullRequestReviewComment returns the specific inline comment given its
+// unique Github ID, or nil if it has been deleted
+func (c *GithubClient) GetPullRequestReviewComment(commentID int64) (*github.PullRequestComment, error) {
+  comment, resp, err := c.Client.PullRequests.GetComment(
+    context.TODO(),
+    c.Owner,
+    c.Repository,
+    commentID,
+  )
+  if resp != nil && resp.StatusCode == http.StatusNotFound {
+    return nil, nil
+  } else if err != nil {
+    return nil, err
+  }
+
+  return comment, nil
+}
+
+// ListPullRequestTimeline returns the timeline of events for the specific pull
+// request given its ID relative to the configured repo
+func (c *GithubClient) ListPullRequestTimeline(prID int) ([]*TimelineEvent, error) {
+  if events, ok := timelineCache[prID]; ok {
+    return events, nil
+  }
+
+  var events []*TimelineEvent
+  page := 1
+
+  for {
+    req, err := c.Client.NewRequest(
+      "GET",
+      fmt.Sprintf("repos/%s/%s/issues/%d/timeline?per_page=100&page=%d",
+        c.Owner,
+        c.Repository,
+        prID,
+        page,
+      ),
+      nil,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    req.Header.Set("Accept", "application/vnd.github.mockingbird-preview+json")
+
+    var more []*TimelineEvent
+    resp, err := c.Client.Do(context.TODO(), req, &more)
+    if err != nil {
+      return nil, err
+    }
+
+    events = append(events, more...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    page = resp.NextPage
+  }
+
+  timelineCache[prID] = events
+
+  return events, nil
+}
+
+// ListPullRequestReactions returns the reactions to the description of the
+// specific pull request given its ID relative to the configured repo
+func (c *GithubClient) ListPullRequestReactions(prID int) ([]*Reaction, error) {
+  return c.listReactions(fmt.Sprintf("repos/%s/%s/issues/%d/reactions",
+    c.Owner,
+    c.Repository,
+    prID,
+  ))
+}
+
+// ListCommentReactions returns the reactions to the specific comment given its
+// unique Github ID
+func (c *GithubClient) ListCommentReactions(commentID int64) ([]*Reaction, error) {
+  return c.listReactions(fmt.Sprintf("repos/%s/%s/issues/comments/%d/reactions",
+    c.Owner,
+    c.Repository,
+    commentID,
+  ))
+}
+
+// listReactions pages through the reactions at the given path
+func (c *GithubClient) listReactions(path string) ([]*Reaction, error) {
+  var reactions []*Reaction
+  page := 1
+
+  for {
+    req, err := c.Client.NewRequest(
+      "GET",
+      fmt.Sprintf("%s?per_page=100&page=%d", path, page),
+      nil,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    req.Header.Set("Accept", "application/vnd.github.squirrel-girl-preview+json")
+
+    var more []*Reaction
+    resp, err := c.Client.Do(context.TODO(), req, &more)
+    if err != nil {
+      return nil, err
+    }
+
+    reactions = append(reactions, more...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    page = resp.NextPage
+  }
+
+  return reactions, nil
+}
+
+// ListPullRequestCommits returns the list of commits for the specific pull
+// request given its ID relative to the configured repo
+func (c *GithubClient) ListPullRequestCommits(prID int) ([]*github.RepositoryCommit, error) {
+  opts := &github.ListOptions{}
+  var commits []*github.RepositoryCommit
+
+  for {
+    more, resp, err := c.Client.PullRequests.ListCommits(
+      context.TODO(),
+      c.Owner,
+      c.Repository,
+      prID,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    commits = append(commits, more...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return commits, nil
+}
+
+// ListPullRequestFiles returns the paths of the files changed by the specific
+// pull request given its ID relative to the configured repo.  For renamed
+// files, both the previous and the new path are returned.
+func (c *GithubClient) ListPullRequestFiles(prID int) ([]string, error) {
+  opts := &github.ListOptions{}
+  var files []string
+
+  for {
+    more, resp, err := c.Client.PullRequests.ListFiles(
+      context.TODO(),
+      c.Owner,
+      c.Repository,
+      prID,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    for _, file := range more {
+      files = append(files, file.GetFilename())
+      if file.GetPreviousFilename() != "" {
+        files = append(files, file.GetPreviousFilename())
+      }
+    }
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return files, nil
+}
+
+// GetFileContents returns the contents of the file at the given path and ref
+// of the configured repo, or nil if the file does not exist
+func (c *GithubClient) GetFileContents(path, ref string) ([]byte, error) {
+  key := ref + ":" + path
+  if contents, ok := contentsCache[key]; ok {
+    return contents, nil
+  }
+
+  file, _, resp, err := c.Client.Repositories.GetContents(
+    context.TODO(),
+    c.Owner,
+    c.Repository,
+    path,
+    &github.RepositoryContentGetOptions{
+      Ref: ref,
+    },
+  )
+  if resp != nil && resp.StatusCode == http.StatusNotFound {
+    contentsCache[key] = nil
+    return nil, nil
+  } else if err != nil {
+    return nil, err
+  }
+
+  if file == nil {
+    return nil, fmt.Errorf("not a file: %s", path)
+  }
+
+  content, err := file.GetContent()
+  if err != nil {
+    return nil, err
+  }
+
+  contentsCache[key] = []byte(content)
+
+  return contentsCache[key], nil
+}
+
+// ListStatuses returns the latest status of each context for the given ref of
+// the configured repo
+func (c *GithubClient) ListStatuses(ref string) ([]*github.RepoStatus, error) {
+  opts := &github.ListOptions{}
+  var statuses []*github.RepoStatus
+
+  for {
+    combined, resp, err := c.Client.Repositories.GetCombinedStatus(
+      context.TODO(),
+      c.Owner,
+      c.Repository,
+      ref,
+      opts,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    statuses = append(statuses, combined.Statuses...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return statuses, nil
+}
+
+// ListCheckRuns returns the latest check runs for the given ref of the
+// configured repo
+func (c *GithubClient) ListCheckRuns(ref string) ([]*github.CheckRun, error) {
+  opts := github.ListOptions{}
+  var runs []*github.CheckRun
+
+  for {
+    result, resp, err := c.Client.Checks.ListCheckRunsForRef(
+      context.TODO(),
+      c.Owner,
+      c.Repository,
+      ref,
+      &github.ListCheckRunsOptions{
+        ListOptions: opts,
+      },
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    runs = append(runs, result.CheckRuns...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    opts.Page = resp.NextPage
+  }
+
+  return runs, nil
+}
+
+// ListCheckSuites returns the check suites for the given ref of the configured
+// repo
+func (c *GithubClient) ListCheckSuites(ref string) ([]*CheckSuite, error) {
+  var suites []*CheckSuite
+  page := 1
+
+  for {
+    req, err := c.Client.NewRequest(
+      "GET",
+      fmt.Sprintf("repos/%s/%s/commits/%s/check-suites?per_page=100&page=%d",
+        c.Owner,
+        c.Repository,
+        ref,
+        page,
+      ),
+      nil,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    var result struct {
+      CheckSuites []*CheckSuite `json:"check_suites"`
+    }
+    resp, err := c.Client.Do(context.TODO(), req, &result)
+    if err != nil {
+      return nil, err
+    }
+
+    suites = append(suites, result.CheckSuites...)
+
+    if resp.NextPage == 0 {
+      break
+    }
+
+    page = resp.NextPage
+  }
+
+  return suites, nil
+}
+
 func (c *GithubClient) SetPullRequestState(prID int, state string) error {
   validState := false
   validStates := []string{"open", "closed"}
@@ -465,36 +943,144 @@ func (c *GithubClient) ListTeamMembers(orgTeam string) ([]string, error) {
   return usernames, nil
 }
 
+// UserMemberOfTeam determines whether the user is a member of the team, given
+// as `org/team` with or without a leading `@`.  The members of each team are
+// only listed once.
 func (c *GithubClient) UserMemberOfTeam(username, team string) (bool, error) {
-  if teams, ok := userTeamCache[username]; ok {
-    for _, t := range teams {
-      if team == t {
-        return true, nil
-      }
+  key := strings.ToLower(strings.TrimPrefix(team, "@"))
+
+  members, ok := teamMembersCache[key]
+  if !ok {
+    list, err := c.ListTeamMembers(team)
+    if err != nil {
+      return false, nil
+    }
+
+    // Cache request
+    members = make(map[string]bool)
+    for _, member := range list {
+      members[strings.ToLower(member)] = true
     }
 
-    return false, nil
+    teamMembersCache[key] = members
+  }
+
+  return members[strings.ToLower(username)], nil
+}
+
+// ListUserEmails returns the public email address of the user's profile, if
+// any
+func (c *GithubClient) ListUserEmails(username string) ([]string, error) {
+  if emails, ok := userEmailsCache[username]; ok {
+    return emails, nil
   }
 
-  members, err := c.ListTeamMembers(team)
+  user, _, err := c.Client.Users.Get(context.TODO(), username)
   if err != nil {
-    return false, nil
+    return nil, err
   }
 
-  // Cache request
-  for _, member := range members {
-    userTeamCache[member] = append(userTeamCache[member], team)
+  var emails []string
+  if user.GetEmail() != "" {
+    emails = append(emails, strings.ToLower(user.GetEmail()))
   }
 
-  if teams, ok := userTeamCache[username]; ok {
-    for _, t := range teams {
-      if team == t {
-        return true, nil
-      }
+  userEmailsCache[username] = emails
+
+  return emails, nil
+}
+
+// ListUserCommitEmails returns the email addresses of the most recent commits
+// to the configured repo which Github attributes to the user.  Commits are only
+// attributed by email addresses which the user has verified.
+func (c *GithubClient) ListUserCommitEmails(username string) ([]string, error) {
+  if emails, ok := commitEmailsCache[username]; ok {
+    return emails, nil
+  }
+
+  commits, _, err := c.Client.Repositories.ListCommits(
+    context.TODO(),
+    c.Owner,
+    c.Repository,
+    &github.CommitsListOptions{
+      Author:      username,
+      ListOptions: github.ListOptions{
+        PerPage: 100,
+      },
+    },
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  seen := make(map[string]bool)
+  var emails []string
+
+  for _, commit := range commits {
+    if !strings.EqualFold(commit.GetAuthor().GetLogin(), username) {
+      continue
+    }
+
+    email := strings.ToLower(commit.GetCommit().GetAuthor().GetEmail())
+    if email != "" && !seen[email] {
+      seen[email] = true
+      emails = append(emails, email)
     }
   }
 
-  return false, nil
+  commitEmailsCache[username] = emails
+
+  return emails, nil
+}
+
+// collaboratorPermission is the permission of a user on a repository, where
+// the role name distinguishes the triage and maintain roles from read and
+// write respectively
+type collaboratorPermission struct {
+  Permission string `json:"permission"`
+  RoleName   string `json:"role_name"`
+}
+
+// GetCollaboratorPermission returns the role of the user on the configured
+// repo, which is one of `read`, `triage`, `write`, `maintain` or `admin`, or
+// `none` if the user has no access
+func (c *GithubClient) GetCollaboratorPermission(username string) (string, error) {
+  if permission, ok := permissionCache[username]; ok {
+    return permission, nil
+  }
+
+  req, err := c.Client.NewRequest(
+    "GET",
+    fmt.Sprintf("repos/%s/%s/collaborators/%s/permission",
+      c.Owner,
+      c.Repository,
+      username,
+    ),
+    nil,
+  )
+  if err != nil {
+    return "", err
+  }
+
+  var level collaboratorPermission
+  resp, err := c.Client.Do(context.TODO(), req, &level)
+  if resp != nil && resp.StatusCode == http.StatusNotFound {
+    level.Permission = "none"
+  } else if err != nil {
+    return "", err
+  }
+
+  // Custom roles are reported by their name, in which case the permission
+  // they are based on is used instead
+  permission := level.Permission
+  switch level.RoleName {
+  case "read", "triage", "write", "maintain", "admin":
+    permission = level.RoleName
+  }
+
+  permissionCache[username] = permission
+
+  return permission, nil
 }
 
 func parseRepository(s string) (string, string, error) {
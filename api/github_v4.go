@@ -0,0 +1,883 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "fmt"
+  "sort"
+  "time"
+  "strings"
+
+  "github.com/google/go-github/v32/github"
+)
+
+// GithubV4Client gathers pull requests together with their comments and
+// reviews in batched queries against the Github v4 API.  All other actions are
+// performed against the REST API by the embedded client.
+type GithubV4Client struct {
+  *GithubClient
+  comments      map[int][]*github.IssueComment
+  reviews       map[int][]*github.PullRequestReview
+  commentsAfter map[int]string
+  reviewsAfter  map[int]string
+}
+
+// NewGithubV4Client for creating a new instance of the v4 client.
+func NewGithubV4Client(repo string, accessToken string, skipSSL bool, githubEndpoint string) (*GithubV4Client, error) {
+  client, err := NewGithubClient(repo, accessToken, skipSSL, githubEndpoint)
+  if err != nil {
+    return nil, err
+  }
+
+  return &GithubV4Client{
+    GithubClient:  client,
+    comments:      make(map[int][]*github.IssueComment),
+    reviews:       make(map[int][]*github.PullRequestReview),
+    commentsAfter: make(map[int]string),
+    reviewsAfter:  make(map[int]string),
+  }, nil
+}
+
+// The number of pull requests requested per page.  Each pull request carries
+// its first page of comments and reviews, so this is kept low to stay within
+// the node limit of the v4 API.
+const v4PullRequestsPerPage = 25
+
+const v4PageInfo = `pageInfo { hasNextPage endCursor }`
+
+const v4Actor = `
+  __typename
+  login
+  avatarUrl
+  url
+  ... on User { databaseId }
+  ... on Bot { databaseId }
+`
+
+const v4Comment = `
+  id
+  databaseId
+  body
+  createdAt
+  updatedAt
+  url
+  authorAssociation
+  author {` + v4Actor + `}
+`
+
+const v4Review = `
+  id
+  databaseId
+  body
+  state
+  submittedAt
+  url
+  authorAssociation
+  commit { oid }
+  author {` + v4Actor + `}
+`
+
+const v4PullRequest = `
+  id
+  databaseId
+  number
+  title
+  body
+  url
+  state
+  merged
+  isDraft
+  mergeable
+  mergeStateStatus
+  createdAt
+  updatedAt
+  authorAssociation
+  author {` + v4Actor + `}
+  headRefName
+  headRefOid
+  baseRefName
+  baseRefOid
+  headRepository { nameWithOwner url isFork owner { login } }
+  baseRepository { nameWithOwner url isFork owner { login } }
+  labels(first: 100) { nodes { name } }
+  assignees(first: 100) { nodes { login databaseId } }
+  reviewRequests(first: 100) {
+    nodes {
+      requestedReviewer {
+        __typename
+        ... on User { login databaseId }
+        ... on Team { slug organization { login } }
+      }
+    }
+  }
+  comments(first: 100) { ` + v4PageInfo + ` nodes {` + v4Comment + `} }
+  reviews(first: 100) { ` + v4PageInfo + ` nodes {` + v4Review + `} }
+`
+
+const v4ListPullRequestsQuery = `
+query($owner: String!, $name: String!, $states: [PullRequestState!], $first: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(states: $states, first: $first, after: $after, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      ` + v4PageInfo + `
+      nodes {` + v4PullRequest + `}
+    }
+  }
+}
+`
+
+const v4GetPullRequestQuery = `
+query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {` + v4PullRequest + `}
+  }
+}
+`
+
+const v4ListCommentsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      comments(first: 100, after: $after) { ` + v4PageInfo + ` nodes {` + v4Comment + `} }
+    }
+  }
+}
+`
+
+const v4ListContentEditsQuery = `
+query($id: ID!, $after: String) {
+  node(id: $id) {
+    ... on Comment {
+      userContentEdits(first: 100, after: $after) {
+        ` + v4PageInfo + `
+        nodes { editedAt deletedAt diff editor { login } }
+      }
+    }
+  }
+}
+`
+
+const v4ListReviewThreadsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $after) {
+        ` + v4PageInfo + `
+        nodes {
+          isResolved
+          isOutdated
+          path
+          line
+          first: comments(first: 1) { nodes { url createdAt author {` + v4Actor + `} } }
+          last: comments(last: 1) { nodes { createdAt } }
+        }
+      }
+    }
+  }
+}
+`
+
+const v4ListReviewsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviews(first: 100, after: $after) { ` + v4PageInfo + ` nodes {` + v4Review + `} }
+    }
+  }
+}
+`
+
+type v4PageInfoNode struct {
+  HasNextPage bool   `json:"hasNextPage"`
+  EndCursor   string `json:"endCursor"`
+}
+
+type v4ActorNode struct {
+  Typename   string `json:"__typename"`
+  Login      string `json:"login"`
+  AvatarURL  string `json:"avatarUrl"`
+  URL        string `json:"url"`
+  DatabaseID int64  `json:"databaseId"`
+}
+
+type v4CommentNode struct {
+  ID                string       `json:"id"`
+  DatabaseID        int64        `json:"databaseId"`
+  Body              string       `json:"body"`
+  CreatedAt         time.Time    `json:"createdAt"`
+  UpdatedAt         time.Time    `json:"updatedAt"`
+  URL               string       `json:"url"`
+  AuthorAssociation string       `json:"authorAssociation"`
+  Author            *v4ActorNode `json:"author"`
+}
+
+type v4CommentConnection struct {
+  PageInfo v4PageInfoNode   `json:"pageInfo"`
+  Nodes    []*v4CommentNode `json:"nodes"`
+}
+
+type v4ReviewNode struct {
+  ID                string       `json:"id"`
+  DatabaseID        int64        `json:"databaseId"`
+  Body              string       `json:"body"`
+  State             string       `json:"state"`
+  SubmittedAt       time.Time    `json:"submittedAt"`
+  URL               string       `json:"url"`
+  AuthorAssociation string       `json:"authorAssociation"`
+  Commit            *struct {
+    OID string `json:"oid"`
+  } `json:"commit"`
+  Author            *v4ActorNode `json:"author"`
+}
+
+type v4ReviewConnection struct {
+  PageInfo v4PageInfoNode  `json:"pageInfo"`
+  Nodes    []*v4ReviewNode `json:"nodes"`
+}
+
+type v4ContentEditNode struct {
+  EditedAt  time.Time    `json:"editedAt"`
+  DeletedAt *time.Time   `json:"deletedAt"`
+  Diff      *string      `json:"diff"`
+  Editor    *v4ActorNode `json:"editor"`
+}
+
+type v4ReviewThreadNode struct {
+  IsResolved bool   `json:"isResolved"`
+  IsOutdated bool   `json:"isOutdated"`
+  Path       string `json:"path"`
+  Line       *int   `json:"line"`
+  First      struct {
+    Nodes []struct {
+      URL       string       `json:"url"`
+      CreatedAt time.Time    `json:"createdAt"`
+      Author    *v4ActorNode `json:"author"`
+    } `json:"nodes"`
+  } `json:"first"`
+  Last       struct {
+    Nodes []struct {
+      CreatedAt time.Time `json:"createdAt"`
+    } `json:"nodes"`
+  } `json:"last"`
+}
+
+type v4RepositoryNode struct {
+  NameWithOwner string `json:"nameWithOwner"`
+  URL           string `json:"url"`
+  IsFork        bool   `json:"isFork"`
+  Owner         struct {
+    Login string `json:"login"`
+  } `json:"owner"`
+}
+
+type v4PullRequestNode struct {
+  ID                string            `json:"id"`
+  DatabaseID        int64             `json:"databaseId"`
+  Number            int               `json:"number"`
+  Title             string            `json:"title"`
+  Body              string            `json:"body"`
+  URL               string            `json:"url"`
+  State             string            `json:"state"`
+  Merged            bool              `json:"merged"`
+  IsDraft           bool              `json:"isDraft"`
+  Mergeable         string            `json:"mergeable"`
+  MergeStateStatus  string            `json:"mergeStateStatus"`
+  CreatedAt         time.Time         `json:"createdAt"`
+  UpdatedAt         time.Time         `json:"updatedAt"`
+  AuthorAssociation string            `json:"authorAssociation"`
+  Author            *v4ActorNode      `json:"author"`
+  HeadRefName       string            `json:"headRefName"`
+  HeadRefOID        string            `json:"headRefOid"`
+  BaseRefName       string            `json:"baseRefName"`
+  BaseRefOID        string            `json:"baseRefOid"`
+  HeadRepository    *v4RepositoryNode `json:"headRepository"`
+  BaseRepository    *v4RepositoryNode `json:"baseRepository"`
+  Labels            struct {
+    Nodes []struct {
+      Name string `json:"name"`
+    } `json:"nodes"`
+  } `json:"labels"`
+  Assignees         struct {
+    Nodes []*v4ActorNode `json:"nodes"`
+  } `json:"assignees"`
+  ReviewRequests    struct {
+    Nodes []struct {
+      RequestedReviewer struct {
+        Typename     string `json:"__typename"`
+        Login        string `json:"login"`
+        DatabaseID   int64  `json:"databaseId"`
+        Slug         string `json:"slug"`
+        Organization struct {
+          Login string `json:"login"`
+        } `json:"organization"`
+      } `json:"requestedReviewer"`
+    } `json:"nodes"`
+  } `json:"reviewRequests"`
+  Comments          v4CommentConnection `json:"comments"`
+  Reviews           v4ReviewConnection  `json:"reviews"`
+}
+
+// ListPullRequests returns the list of pull requests for the configured repo
+// in the given states, most recently updated first.  The first page of
+// comments and reviews of each pull request is retrieved in the same query.
+func (c *GithubV4Client) ListPullRequests(states []string, since time.Time) ([]*github.PullRequest, error) {
+  var pulls []*github.PullRequest
+  var after *string
+
+  for {
+    var res struct {
+      Repository struct {
+        PullRequests struct {
+          PageInfo v4PageInfoNode       `json:"pageInfo"`
+          Nodes    []*v4PullRequestNode `json:"nodes"`
+        } `json:"pullRequests"`
+      } `json:"repository"`
+    }
+
+    err := c.GraphQL.Query(v4ListPullRequestsQuery, map[string]interface{}{
+      "owner":  c.Owner,
+      "name":   c.Repository,
+      "states": v4PullRequestStates(states),
+      "first":  v4PullRequestsPerPage,
+      "after":  after,
+    }, &res)
+    if err != nil {
+      return nil, err
+    }
+
+    for _, node := range res.Repository.PullRequests.Nodes {
+      if node.UpdatedAt.Before(since) {
+        return pulls, nil
+      }
+
+      pulls = append(pulls, c.cachePullRequest(node))
+    }
+
+    if !res.Repository.PullRequests.PageInfo.HasNextPage {
+      break
+    }
+
+    after = &res.Repository.PullRequests.PageInfo.EndCursor
+  }
+
+  return pulls, nil
+}
+
+// GetPullRequest returns the specific pull request given its ID relative to the
+// configured repo
+func (c *GithubV4Client) GetPullRequest(prID int) (*github.PullRequest, error) {
+  var res struct {
+    Repository struct {
+      PullRequest *v4PullRequestNode `json:"pullRequest"`
+    } `json:"repository"`
+  }
+
+  err := c.GraphQL.Query(v4GetPullRequestQuery, map[string]interface{}{
+    "owner":  c.Owner,
+    "name":   c.Repository,
+    "number": prID,
+  }, &res)
+  if err != nil {
+    return nil, err
+  }
+
+  if res.Repository.PullRequest == nil {
+    return nil, fmt.Errorf("could not find pull request: %d", prID)
+  }
+
+  return c.cachePullRequest(res.Repository.PullRequest), nil
+}
+
+// ListPullRequestComments returns the list of comments for the specific pull
+// request given its ID relative to the configured repo
+func (c *GithubV4Client) ListPullRequestComments(prID int) ([]*github.IssueComment, error) {
+  comments, ok := c.comments[prID]
+  if ok {
+    after, more := c.commentsAfter[prID]
+    if !more {
+      return comments, nil
+    }
+
+    rest, err := c.listComments(prID, &after)
+    if err != nil {
+      return nil, err
+    }
+
+    comments = append(comments, rest...)
+    delete(c.commentsAfter, prID)
+  } else {
+    var err error
+    comments, err = c.listComments(prID, nil)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  c.comments[prID] = comments
+
+  return comments, nil
+}
+
+// ListPullRequestReviews returns the list of reviews for the specific pull
+// request given its ID relative to the configured repo
+func (c *GithubV4Client) ListPullRequestReviews(prID int) ([]*github.PullRequestReview, error) {
+  reviews, ok := c.reviews[prID]
+  if ok {
+    after, more := c.reviewsAfter[prID]
+    if !more {
+      return reviews, nil
+    }
+
+    rest, err := c.listReviews(prID, &after)
+    if err != nil {
+      return nil, err
+    }
+
+    reviews = append(reviews, rest...)
+    delete(c.reviewsAfter, prID)
+  } else {
+    var err error
+    reviews, err = c.listReviews(prID, nil)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  c.reviews[prID] = reviews
+
+  return reviews, nil
+}
+
+// cachePullRequest converts the pull request and stores the first page of its
+// comments and reviews.  Any remaining pages are only retrieved once they are
+// requested, as most pull requests are never looked at past the selectors.
+func (c *GithubV4Client) cachePullRequest(node *v4PullRequestNode) *github.PullRequest {
+  var comments []*github.IssueComment
+  for _, comment := range node.Comments.Nodes {
+    comments = append(comments, comment.toComment())
+  }
+
+  var reviews []*github.PullRequestReview
+  for _, review := range node.Reviews.Nodes {
+    reviews = append(reviews, review.toReview())
+  }
+
+  c.comments[node.Number] = comments
+  c.reviews[node.Number] = reviews
+
+  delete(c.commentsAfter, node.Number)
+  if node.Comments.PageInfo.HasNextPage {
+    c.commentsAfter[node.Number] = node.Comments.PageInfo.EndCursor
+  }
+
+  delete(c.reviewsAfter, node.Number)
+  if node.Reviews.PageInfo.HasNextPage {
+    c.reviewsAfter[node.Number] = node.Reviews.PageInfo.EndCursor
+  }
+
+  return node.toPullRequest()
+}
+
+// listComments pages through the comments of a pull request starting after
+// the given cursor
+func (c *GithubV4Client) listComments(prID int, after *string) ([]*github.IssueComment, error) {
+  var comments []*github.IssueComment
+
+  for {
+    var res struct {
+      Repository struct {
+        PullRequest *struct {
+          Comments v4CommentConnection `json:"comments"`
+        } `json:"pullRequest"`
+      } `json:"repository"`
+    }
+
+    err := c.GraphQL.Query(v4ListCommentsQuery, map[string]interface{}{
+      "owner":  c.Owner,
+      "name":   c.Repository,
+      "number": prID,
+      "after":  after,
+    }, &res)
+    if err != nil {
+      return nil, err
+    }
+
+    if res.Repository.PullRequest == nil {
+      return nil, fmt.Errorf("could not find pull request: %d", prID)
+    }
+
+    for _, comment := range res.Repository.PullRequest.Comments.Nodes {
+      comments = append(comments, comment.toComment())
+    }
+
+    if !res.Repository.PullRequest.Comments.PageInfo.HasNextPage {
+      break
+    }
+
+    after = &res.Repository.PullRequest.Comments.PageInfo.EndCursor
+  }
+
+  return comments, nil
+}
+
+// listReviews pages through the reviews of a pull request starting after the
+// given cursor
+func (c *GithubV4Client) listReviews(prID int, after *string) ([]*github.PullRequestReview, error) {
+  var reviews []*github.PullRequestReview
+
+  for {
+    var res struct {
+      Repository struct {
+        PullRequest *struct {
+          Reviews v4ReviewConnection `json:"reviews"`
+        } `json:"pullRequest"`
+      } `json:"repository"`
+    }
+
+    err := c.GraphQL.Query(v4ListReviewsQuery, map[string]interface{}{
+      "owner":  c.Owner,
+      "name":   c.Repository,
+      "number": prID,
+      "after":  after,
+    }, &res)
+    if err != nil {
+      return nil, err
+    }
+
+    if res.Repository.PullRequest == nil {
+      return nil, fmt.Errorf("could not find pull request: %d", prID)
+    }
+
+    for _, review := range res.Repository.PullRequest.Reviews.Nodes {
+      reviews = append(reviews, review.toReview())
+    }
+
+    if !res.Repository.PullRequest.Reviews.PageInfo.HasNextPage {
+      break
+    }
+
+    after = &res.Repository.PullRequest.Reviews.PageInfo.EndCursor
+  }
+
+  return reviews, nil
+}
+
+// v4PullRequestStates converts the v3 states into v4 states, where a closed
+// pull request may have also been merged
+func v4PullRequestStates(states []string) []string {
+  if len(states) != 1 {
+    return nil
+  }
+
+  switch states[0] {
+  case "open":
+    return []string{"OPEN"}
+  case "closed":
+    return []string{"CLOSED", "MERGED"}
+  }
+
+  return nil
+}
+
+// toUser converts the actor into its v3 representation.  Actors of deleted
+// accounts are represented by the ghost user, as done by the v3 API.
+func (a *v4ActorNode) toUser() *github.User {
+  if a == nil {
+    return &github.User{
+      ID:    github.Int64(0),
+      Login: github.String("ghost"),
+      Type:  github.String("User"),
+    }
+  }
+
+  return &github.User{
+    ID:        github.Int64(a.DatabaseID),
+    Login:     github.String(a.Login),
+    Type:      github.String(a.Typename),
+    AvatarURL: github.String(a.AvatarURL),
+    HTMLURL:   github.String(a.URL),
+  }
+}
+
+// toComment converts the comment into its v3 representation
+func (n *v4CommentNode) toComment() *github.IssueComment {
+  return &github.IssueComment{
+    ID:                github.Int64(n.DatabaseID),
+    NodeID:            github.String(n.ID),
+    Body:              github.String(n.Body),
+    User:              n.Author.toUser(),
+    AuthorAssociation: github.String(n.AuthorAssociation),
+    CreatedAt:         &n.CreatedAt,
+    UpdatedAt:         &n.UpdatedAt,
+    HTMLURL:           github.String(n.URL),
+  }
+}
+
+// toReview converts the review into its v3 representation
+func (n *v4ReviewNode) toReview() *github.PullRequestReview {
+  review := &github.PullRequestReview{
+    ID:                github.Int64(n.DatabaseID),
+    NodeID:            github.String(n.ID),
+    Body:              github.String(n.Body),
+    State:             github.String(n.State),
+    User:              n.Author.toUser(),
+    AuthorAssociation: github.String(n.AuthorAssociation),
+    SubmittedAt:       &n.SubmittedAt,
+    HTMLURL:           github.String(n.URL),
+  }
+
+  if n.Commit != nil {
+    review.CommitID = github.String(n.Commit.OID)
+  }
+
+  return review
+}
+
+// toRepository converts the repository into its v3 representation
+func (n *v4RepositoryNode) toRepository() *github.Repository {
+  if n == nil {
+    return nil
+  }
+
+  return &github.Repository{
+    FullName: github.String(n.NameWithOwner),
+    HTMLURL:  github.String(n.URL),
+    CloneURL: github.String(n.URL + ".git"),
+    GitURL:   github.String(n.URL + ".git"),
+    Fork:     github.Bool(n.IsFork),
+    Owner:    &github.User{
+      Login: github.String(n.Owner.Login),
+    },
+  }
+}
+
+// toPullRequest converts the pull request into its v3 representation
+func (n *v4PullRequestNode) toPullRequest() *github.PullRequest {
+  state := "open"
+  if n.State != "OPEN" {
+    state = "closed"
+  }
+
+  pull := &github.PullRequest{
+    ID:                github.Int64(n.DatabaseID),
+    NodeID:            github.String(n.ID),
+    Number:            github.Int(n.Number),
+    Title:             github.String(n.Title),
+    Body:              github.String(n.Body),
+    HTMLURL:           github.String(n.URL),
+    State:             github.String(state),
+    Merged:            github.Bool(n.Merged),
+    Draft:             github.Bool(n.IsDraft),
+    MergeableState:    github.String(strings.ToLower(n.MergeStateStatus)),
+    CreatedAt:         &n.CreatedAt,
+    UpdatedAt:         &n.UpdatedAt,
+    AuthorAssociation: github.String(n.AuthorAssociation),
+    User:              n.Author.toUser(),
+    Head:              &github.PullRequestBranch{
+      Ref:  github.String(n.HeadRefName),
+      SHA:  github.String(n.HeadRefOID),
+      Repo: n.HeadRepository.toRepository(),
+    },
+    Base:              &github.PullRequestBranch{
+      Ref:  github.String(n.BaseRefName),
+      SHA:  github.String(n.BaseRefOID),
+      Repo: n.BaseRepository.toRepository(),
+    },
+  }
+
+  // Mergeability is unknown while it is still being computed
+  switch n.Mergeable {
+  case "MERGEABLE":
+    pull.Mergeable = github.Bool(true)
+  case "CONFLICTING":
+    pull.Mergeable = github.Bool(false)
+  }
+
+  for _, label := range n.Labels.Nodes {
+    pull.Labels = append(pull.Labels, &github.Label{
+      Name: github.String(label.Name),
+    })
+  }
+
+  for _, assignee := range n.Assignees.Nodes {
+    pull.Assignees = append(pull.Assignees, assignee.toUser())
+  }
+
+  for _, request := range n.ReviewRequests.Nodes {
+    reviewer := request.RequestedReviewer
+
+    switch reviewer.Typename {
+    case "User":
+      pull.RequestedReviewers = append(pull.RequestedReviewers, &github.User{
+        ID:    github.Int64(reviewer.DatabaseID),
+        Login: github.String(reviewer.Login),
+      })
+    case "Team":
+      pull.RequestedTeams = append(pull.RequestedTeams, &github.Team{
+        Slug:         github.String(reviewer.Slug),
+        Organization: &github.Organization{
+          Login: github.String(reviewer.Organization.Login),
+        },
+      })
+    }
+  }
+
+  return pull
+}
+
+// ListContentEdits returns the edit history of the comment or review given its
+// node ID, oldest first.  The first revision is the original body, and the
+// history is empty if it was never edited.  The v4 API is used regardless of
+// the API used to gather pull requests, as the v3 API offers no such history.
+func (c *GithubClient) ListContentEdits(nodeID string) ([]*ContentEdit, error) {
+  var edits []*ContentEdit
+  var after *string
+
+  for {
+    var res struct {
+      Node *struct {
+        UserContentEdits *struct {
+          PageInfo v4PageInfoNode       `json:"pageInfo"`
+          Nodes    []*v4ContentEditNode `json:"nodes"`
+        } `json:"userContentEdits"`
+      } `json:"node"`
+    }
+
+    err := c.GraphQL.Query(v4ListContentEditsQuery, map[string]interface{}{
+      "id":    nodeID,
+      "after": after,
+    }, &res)
+    if err != nil {
+      return nil, err
+    }
+
+    if res.Node == nil || res.Node.UserContentEdits == nil {
+      return nil, fmt.Errorf("could not find comment or review: %s", nodeID)
+    }
+
+    for _, node := range res.Node.UserContentEdits.Nodes {
+      edit := &ContentEdit{
+        Editor:   node.Editor.toUser().GetLogin(),
+        EditedAt: node.EditedAt,
+        Deleted:  node.DeletedAt != nil,
+      }
+
+      if node.Diff != nil {
+        edit.Body = *node.Diff
+      }
+
+      edits = append(edits, edit)
+    }
+
+    if !res.Node.UserContentEdits.PageInfo.HasNextPage {
+      break
+    }
+
+    after = &res.Node.UserContentEdits.PageInfo.EndCursor
+  }
+
+  // The history is returned most recent first
+  sort.SliceStable(edits, func(i, j int) bool {
+    return edits[i].EditedAt.Before(edits[j].EditedAt)
+  })
+
+  return edits, nil
+}
+
+// ListReviewThreads returns the conversations on the diff of the specific pull
+// request given its ID relative to the configured repo.  The v4 API is used
+// regardless of the API used to gather pull requests, as the v3 API does not
+// expose whether a conversation is resolved.
+func (c *GithubClient) ListReviewThreads(prID int) ([]*ReviewThread, error) {
+  var threads []*ReviewThread
+  var after *string
+
+  for {
+    var res struct {
+      Repository struct {
+        PullRequest *struct {
+          ReviewThreads struct {
+            PageInfo v4PageInfoNode        `json:"pageInfo"`
+            Nodes    []*v4ReviewThreadNode `json:"nodes"`
+          } `json:"reviewThreads"`
+        } `json:"pullRequest"`
+      } `json:"repository"`
+    }
+
+    err := c.GraphQL.Query(v4ListReviewThreadsQuery, map[string]interface{}{
+      "owner":  c.Owner,
+      "name":   c.Repository,
+      "number": prID,
+      "after":  after,
+    }, &res)
+    if err != nil {
+      return nil, err
+    }
+
+    if res.Repository.PullRequest == nil {
+      return nil, fmt.Errorf("could not find pull request: %d", prID)
+    }
+
+    for _, node := range res.Repository.PullRequest.ReviewThreads.Nodes {
+      thread := &ReviewThread{
+        Path:     node.Path,
+        Resolved: node.IsResolved,
+        Outdated: node.IsOutdated,
+      }
+
+      if node.Line != nil {
+        thread.Line = *node.Line
+      }
+
+      if len(node.First.Nodes) > 0 {
+        first := node.First.Nodes[0]
+        thread.URL = first.URL
+        thread.User = first.Author.toUser()
+        thread.UserLogin = thread.User.GetLogin()
+        thread.CreatedAt = first.CreatedAt
+        thread.UpdatedAt = first.CreatedAt
+      }
+
+      if len(node.Last.Nodes) > 0 {
+        thread.UpdatedAt = node.Last.Nodes[0].CreatedAt
+      }
+
+      threads = append(threads, thread)
+    }
+
+    if !res.Repository.PullRequest.ReviewThreads.PageInfo.HasNextPage {
+      break
+    }
+
+    after = &res.Repository.PullRequest.ReviewThreads.PageInfo.EndCursor
+  }
+
+  return threads, nil
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "fmt"
+  "bytes"
+  "context"
+  "strings"
+  "net/url"
+  "net/http"
+  "io/ioutil"
+  "encoding/json"
+)
+
+// GraphQLClient performs queries against the Github v4 API.
+type GraphQLClient struct {
+  Endpoint string
+  Client   *http.Client
+}
+
+// graphqlRequest is the body of a query sent to the v4 API
+type graphqlRequest struct {
+  Query     string                 `json:"query"`
+  Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphqlResponse is the body of the response returned by the v4 API
+type graphqlResponse struct {
+  Data   json.RawMessage `json:"data"`
+  Errors []struct {
+    Message string `json:"message"`
+  } `json:"errors"`
+}
+
+// Query performs the given query with the provided variables and decodes the
+// returned data into out
+func (g *GraphQLClient) Query(query string, variables map[string]interface{}, out interface{}) error {
+  body, err := json.Marshal(&graphqlRequest{
+    Query:     query,
+    Variables: variables,
+  })
+  if err != nil {
+    return fmt.Errorf("could not marshal query: %s", err)
+  }
+
+  req, err := http.NewRequestWithContext(
+    context.TODO(),
+    http.MethodPost,
+    g.Endpoint,
+    bytes.NewReader(body),
+  )
+  if err != nil {
+    return err
+  }
+
+  req.Header.Set("Content-Type", "application/json")
+
+  // Merge state information is still a preview on some Enterprise versions
+  req.Header.Set("Accept", "application/vnd.github.merge-info-preview+json")
+
+  resp, err := g.Client.Do(req)
+  if err != nil {
+    return err
+  }
+
+  defer resp.Body.Close()
+
+  b, err := ioutil.ReadAll(resp.Body)
+  if err != nil {
+    return err
+  }
+
+  if resp.StatusCode != http.StatusOK {
+    return fmt.Errorf("unexpected status from v4 API: %s: %s", resp.Status, b)
+  }
+
+  var res graphqlResponse
+  if err := json.Unmarshal(b, &res); err != nil {
+    return fmt.Errorf("could not unmarshal response: %s", err)
+  }
+
+  if len(res.Errors) > 0 {
+    var messages []string
+    for _, e := range res.Errors {
+      messages = append(messages, e.Message)
+    }
+
+    return fmt.Errorf("query failed: %s", strings.Join(messages, "; "))
+  }
+
+  if err := json.Unmarshal(res.Data, out); err != nil {
+    return fmt.Errorf("could not unmarshal data: %s", err)
+  }
+
+  return nil
+}
+
+// parseGraphQLEndpoint determines the v4 endpoint from the v3 endpoint, which
+// for Enterprise instances is located next to the v3 API under `/api`
+func parseGraphQLEndpoint(githubEndpoint string) (string, error) {
+  if githubEndpoint == "" {
+    return "https://api.github.com/graphql", nil
+  }
+
+  endpoint, err := url.Parse(githubEndpoint)
+  if err != nil {
+    return "", err
+  }
+
+  if endpoint.Host == "api.github.com" {
+    endpoint.Path = "/graphql"
+    return endpoint.String(), nil
+  }
+
+  path := strings.TrimSuffix(endpoint.Path, "/")
+  path = strings.TrimSuffix(path, "/v3")
+  if !strings.HasSuffix(path, "/api") {
+    path += "/api"
+  }
+
+  endpoint.Path = path + "/graphql"
+
+  return endpoint.String(), nil
+}
@@ -0,0 +1,412 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package api
+
+import (
+  "time"
+  "strings"
+  "strconv"
+  "testing"
+  "net/http"
+  "io/ioutil"
+  "encoding/json"
+  "net/http/httptest"
+
+  "github.com/google/go-github/v32/github"
+)
+
+// countingTransport counts the requests made through it
+type countingTransport struct {
+  next  http.RoundTripper
+  count int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+  c.count++
+  return c.next.RoundTrip(r)
+}
+
+// graphqlStub serves the given responses to queries against the v4 API, keyed
+// by the cursor of the requested page
+func graphqlStub(t *testing.T, pages map[string]string) (*GithubClient, func()) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    // The handler runs on the server's goroutine, so it must not stop the test
+    body, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+      t.Errorf("could not read request: %s", err)
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+    }
+
+    var req graphqlRequest
+    if err := json.Unmarshal(body, &req); err != nil {
+      t.Errorf("could not unmarshal request: %s", err)
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+    }
+
+    after, _ := req.Variables["after"].(string)
+    page, ok := pages[after]
+    if !ok {
+      t.Errorf("unexpected cursor: %q", after)
+      http.Error(w, "unexpected cursor", http.StatusInternalServerError)
+      return
+    }
+
+    w.Write([]byte(page))
+  }))
+
+  client := &GithubClient{
+    Owner:      "unikraft",
+    Repository: "unikraft",
+    GraphQL:    &GraphQLClient{
+      Endpoint: server.URL,
+      Client:   server.Client(),
+    },
+  }
+
+  return client, server.Close
+}
+
+func TestQueryErrors(t *testing.T) {
+  tests := []struct {
+    status int
+    body   string
+    err    string
+  }{
+    {http.StatusBadGateway, `bad gateway`, "unexpected status from v4 API: 502"},
+    {http.StatusOK, `{"errors": [{"message": "a"}, {"message": "b"}]}`, "query failed: a; b"},
+    {http.StatusOK, `{"data": `, "could not unmarshal response"},
+    {http.StatusOK, `{"data": []}`, "could not unmarshal data"},
+  }
+
+  for _, test := range tests {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      w.WriteHeader(test.status)
+      w.Write([]byte(test.body))
+    }))
+
+    g := &GraphQLClient{
+      Endpoint: server.URL,
+      Client:   server.Client(),
+    }
+
+    var out struct{}
+    err := g.Query("query { viewer { login } }", nil, &out)
+    server.Close()
+
+    if err == nil {
+      t.Errorf("Query(%q): expected error containing %q", test.body, test.err)
+      continue
+    }
+
+    if !strings.Contains(err.Error(), test.err) {
+      t.Errorf("Query(%q): expected error containing %q, got %q", test.body, test.err, err)
+    }
+  }
+}
+
+func TestListReviewThreadsPages(t *testing.T) {
+  client, stop := graphqlStub(t, map[string]string{
+    "": `{"data": {"repository": {"pullRequest": {"reviewThreads": {
+      "pageInfo": {"hasNextPage": true, "endCursor": "page2"},
+      "nodes": [{
+        "isResolved": true,
+        "path": "lib/a.c",
+        "line": 12,
+        "first": {"nodes": [{
+          "url": "https://github.com/unikraft/unikraft/pull/1#r1",
+          "createdAt": "2021-01-01T00:00:00Z",
+          "author": {"__typename": "User", "login": "alice", "databaseId": 1}
+        }]},
+        "last": {"nodes": [{"createdAt": "2021-01-02T00:00:00Z"}]}
+      }]
+    }}}}}`,
+    "page2": `{"data": {"repository": {"pullRequest": {"reviewThreads": {
+      "pageInfo": {"hasNextPage": false, "endCursor": ""},
+      "nodes": [{
+        "isOutdated": true,
+        "path": "lib/b.c",
+        "first": {"nodes": [{
+          "url": "https://github.com/unikraft/unikraft/pull/1#r2",
+          "createdAt": "2021-01-03T00:00:00Z",
+          "author": {"__typename": "User", "login": "bob", "databaseId": 2}
+        }]},
+        "last": {"nodes": [{"createdAt": "2021-01-03T00:00:00Z"}]}
+      }]
+    }}}}}`,
+  })
+  defer stop()
+
+  threads, err := client.ListReviewThreads(1)
+  if err != nil {
+    t.Fatalf("ListReviewThreads: %s", err)
+  }
+
+  if len(threads) != 2 {
+    t.Fatalf("ListReviewThreads: expected 2 threads, got %d", len(threads))
+  }
+
+  first, second := threads[0], threads[1]
+  if first.Path != "lib/a.c" || first.Line != 12 || !first.Resolved || first.UserLogin != "alice" {
+    t.Errorf("ListReviewThreads: unexpected first thread: %+v", first)
+  }
+
+  if !first.UpdatedAt.After(first.CreatedAt) {
+    t.Errorf("ListReviewThreads: expected the first thread to be updated by its last comment")
+  }
+
+  if second.Path != "lib/b.c" || second.Line != 0 || !second.Outdated || second.UserLogin != "bob" {
+    t.Errorf("ListReviewThreads: unexpected second thread: %+v", second)
+  }
+}
+
+func TestListReviewThreadsMissing(t *testing.T) {
+  client, stop := graphqlStub(t, map[string]string{
+    "": `{"data": {"repository": {"pullRequest": null}}}`,
+  })
+  defer stop()
+
+  _, err := client.ListReviewThreads(1)
+  if err == nil || !strings.Contains(err.Error(), "could not find pull request: 1") {
+    t.Errorf("ListReviewThreads: expected missing pull request, got %v", err)
+  }
+}
+
+func TestListContentEditsPages(t *testing.T) {
+  client, stop := graphqlStub(t, map[string]string{
+    "": `{"data": {"node": {"userContentEdits": {
+      "pageInfo": {"hasNextPage": true, "endCursor": "page2"},
+      "nodes": [
+        {"editedAt": "2021-01-03T00:00:00Z", "diff": "third", "editor": {"login": "alice"}},
+        {"editedAt": "2021-01-02T00:00:00Z", "deletedAt": "2021-01-04T00:00:00Z", "diff": null, "editor": {"login": "bob"}}
+      ]
+    }}}}`,
+    "page2": `{"data": {"node": {"userContentEdits": {
+      "pageInfo": {"hasNextPage": false, "endCursor": ""},
+      "nodes": [
+        {"editedAt": "2021-01-01T00:00:00Z", "diff": "first", "editor": {"login": "alice"}}
+      ]
+    }}}}`,
+  })
+  defer stop()
+
+  edits, err := client.ListContentEdits("IC_1")
+  if err != nil {
+    t.Fatalf("ListContentEdits: %s", err)
+  }
+
+  var bodies []string
+  for _, edit := range edits {
+    bodies = append(bodies, edit.Body)
+  }
+
+  if got := strings.Join(bodies, ","); got != "first,,third" {
+    t.Errorf("ListContentEdits: expected edits oldest first, got %q", got)
+  }
+
+  if !edits[1].Deleted || edits[1].Editor != "bob" {
+    t.Errorf("ListContentEdits: unexpected second edit: %+v", edits[1])
+  }
+}
+
+func TestParseGraphQLEndpoint(t *testing.T) {
+  tests := []struct {
+    endpoint string
+    want     string
+  }{
+    {"", "https://api.github.com/graphql"},
+    {"https://api.github.com", "https://api.github.com/graphql"},
+    {"https://api.github.com/", "https://api.github.com/graphql"},
+    {"https://github.example.com/api/v3", "https://github.example.com/api/graphql"},
+    {"https://github.example.com/api/v3/", "https://github.example.com/api/graphql"},
+    {"https://github.example.com/api", "https://github.example.com/api/graphql"},
+    {"https://github.example.com", "https://github.example.com/api/graphql"},
+  }
+
+  for _, test := range tests {
+    got, err := parseGraphQLEndpoint(test.endpoint)
+    if err != nil {
+      t.Errorf("parseGraphQLEndpoint(%q): %s", test.endpoint, err)
+      continue
+    }
+
+    if got != test.want {
+      t.Errorf("parseGraphQLEndpoint(%q): expected %q, got %q", test.endpoint, test.want, got)
+    }
+  }
+}
+
+// v4PullRequestPage is a page of pull requests, each given as its JSON node
+func v4PullRequestPage(next string, nodes ...string) string {
+  return `{"data": {"repository": {"pullRequests": {
+    "pageInfo": {"hasNextPage": ` + strconv.FormatBool(next != "") + `, "endCursor": "` + next + `"},
+    "nodes": [` + strings.Join(nodes, ",") + `]
+  }}}}`
+}
+
+// v4PullRequestJSON is a pull request node with the given comments connection
+func v4PullRequestJSON(number int, updatedAt string, comments string) string {
+  return `{
+    "id": "PR_` + strconv.Itoa(number) + `",
+    "databaseId": ` + strconv.Itoa(1000 + number) + `,
+    "number": ` + strconv.Itoa(number) + `,
+    "title": "Fix the build",
+    "url": "https://github.com/unikraft/unikraft/pull/` + strconv.Itoa(number) + `",
+    "state": "OPEN",
+    "isDraft": false,
+    "mergeable": "CONFLICTING",
+    "mergeStateStatus": "DIRTY",
+    "createdAt": "2021-01-01T00:00:00Z",
+    "updatedAt": "` + updatedAt + `",
+    "authorAssociation": "CONTRIBUTOR",
+    "author": {"__typename": "User", "login": "bob", "databaseId": 2},
+    "headRefName": "feature",
+    "headRefOid": "abc",
+    "baseRefName": "staging",
+    "baseRefOid": "def",
+    "headRepository": {"nameWithOwner": "bob/unikraft", "url": "https://github.com/bob/unikraft", "isFork": true, "owner": {"login": "bob"}},
+    "baseRepository": {"nameWithOwner": "unikraft/unikraft", "url": "https://github.com/unikraft/unikraft", "isFork": false, "owner": {"login": "unikraft"}},
+    "labels": {"nodes": [{"name": "bug"}]},
+    "assignees": {"nodes": [{"__typename": "User", "login": "alice", "databaseId": 1}]},
+    "reviewRequests": {"nodes": [
+      {"requestedReviewer": {"__typename": "User", "login": "carol", "databaseId": 3}},
+      {"requestedReviewer": {"__typename": "Team", "slug": "reviewers", "organization": {"login": "unikraft"}}}
+    ]},
+    "comments": ` + comments + `,
+    "reviews": {"pageInfo": {"hasNextPage": false, "endCursor": ""}, "nodes": []}
+  }`
+}
+
+// v4CommentJSON is a comment node by alice with the given ID
+func v4CommentJSON(id int) string {
+  return `{"id": "IC_` + strconv.Itoa(id) + `", "databaseId": ` + strconv.Itoa(id) + `,
+    "body": "Approved-by: Alice <alice@example.com>",
+    "createdAt": "2021-01-02T00:00:00Z", "updatedAt": "2021-01-02T00:00:00Z",
+    "author": {"__typename": "User", "login": "alice", "databaseId": 1}}`
+}
+
+func TestV4ListPullRequestsPages(t *testing.T) {
+  client, stop := graphqlStub(t, map[string]string{
+    "": v4PullRequestPage("pulls2",
+      v4PullRequestJSON(3, "2021-01-05T00:00:00Z", `{
+        "pageInfo": {"hasNextPage": true, "endCursor": "comments2"},
+        "nodes": [` + v4CommentJSON(31) + `]
+      }`),
+    ),
+    "comments2": `{"data": {"repository": {"pullRequest": {"comments": {
+      "pageInfo": {"hasNextPage": false, "endCursor": ""},
+      "nodes": [` + v4CommentJSON(32) + `]
+    }}}}}`,
+    "pulls2": v4PullRequestPage("pulls3",
+      v4PullRequestJSON(2, "2021-01-04T00:00:00Z", `{"pageInfo": {"hasNextPage": false, "endCursor": ""}, "nodes": []}`),
+      v4PullRequestJSON(1, "2021-01-01T00:00:00Z", `{"pageInfo": {"hasNextPage": false, "endCursor": ""}, "nodes": []}`),
+    ),
+  })
+  defer stop()
+
+  queries := &countingTransport{next: client.GraphQL.Client.Transport}
+  client.GraphQL.Client.Transport = queries
+
+  v4 := &GithubV4Client{
+    GithubClient:  client,
+    comments:      make(map[int][]*github.IssueComment),
+    reviews:       make(map[int][]*github.PullRequestReview),
+    commentsAfter: make(map[int]string),
+    reviewsAfter:  make(map[int]string),
+  }
+
+  // Pull requests are listed most recently updated first, so listing stops at
+  // the first one updated before the given time without requesting more pages
+  pulls, err := v4.ListPullRequests([]string{"open"}, time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC))
+  if err != nil {
+    t.Fatalf("ListPullRequests: %s", err)
+  }
+
+  if len(pulls) != 2 || pulls[0].GetNumber() != 3 || pulls[1].GetNumber() != 2 {
+    t.Fatalf("ListPullRequests: expected #3 and #2, got %d pull requests", len(pulls))
+  }
+
+  pull := pulls[0]
+  if pull.GetID() != 1003 || pull.GetNodeID() != "PR_3" || pull.GetState() != "open" ||
+     pull.GetUser().GetLogin() != "bob" || pull.GetAuthorAssociation() != "CONTRIBUTOR" {
+    t.Errorf("ListPullRequests: unexpected pull request: %+v", pull)
+  }
+
+  if pull.Mergeable == nil || pull.GetMergeable() || pull.GetMergeableState() != "dirty" {
+    t.Errorf("ListPullRequests: expected a conflicting pull request, got %v and %q",
+      pull.Mergeable, pull.GetMergeableState())
+  }
+
+  if pull.GetHead().GetRef() != "feature" || pull.GetHead().GetSHA() != "abc" ||
+     pull.GetHead().GetRepo().GetFullName() != "bob/unikraft" || !pull.GetHead().GetRepo().GetFork() ||
+     pull.GetBase().GetRef() != "staging" || pull.GetBase().GetSHA() != "def" ||
+     pull.GetBase().GetRepo().GetCloneURL() != "https://github.com/unikraft/unikraft.git" {
+    t.Errorf("ListPullRequests: unexpected branches: %+v and %+v", pull.GetHead(), pull.GetBase())
+  }
+
+  if len(pull.Labels) != 1 || pull.Labels[0].GetName() != "bug" ||
+     len(pull.Assignees) != 1 || pull.Assignees[0].GetLogin() != "alice" {
+    t.Errorf("ListPullRequests: unexpected labels or assignees: %v, %v", pull.Labels, pull.Assignees)
+  }
+
+  if len(pull.RequestedReviewers) != 1 || pull.RequestedReviewers[0].GetLogin() != "carol" ||
+     len(pull.RequestedTeams) != 1 || pull.RequestedTeams[0].GetSlug() != "reviewers" ||
+     pull.RequestedTeams[0].GetOrganization().GetLogin() != "unikraft" {
+    t.Errorf("ListPullRequests: unexpected review requests: %v, %v",
+      pull.RequestedReviewers, pull.RequestedTeams)
+  }
+
+  // Only the pages of pull requests are queried until comments are requested
+  if queries.count != 2 {
+    t.Errorf("ListPullRequests: expected 2 queries, got %d", queries.count)
+  }
+
+  // The comments of the listed pull request span both pages
+  comments, err := v4.ListPullRequestComments(3)
+  if err != nil {
+    t.Fatalf("ListPullRequestComments: %s", err)
+  }
+
+  if len(comments) != 2 || comments[0].GetID() != 31 || comments[1].GetID() != 32 ||
+     comments[0].GetUser().GetLogin() != "alice" {
+    t.Errorf("ListPullRequestComments: expected comments 31 and 32, got %v", comments)
+  }
+
+  if queries.count != 3 {
+    t.Errorf("ListPullRequestComments: expected 1 more query, got %d", queries.count - 2)
+  }
+
+  // The remaining page is kept once retrieved
+  if _, err := v4.ListPullRequestComments(3); err != nil || queries.count != 3 {
+    t.Errorf("ListPullRequestComments: expected no more queries, got %d (%v)", queries.count - 3, err)
+  }
+}
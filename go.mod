@@ -7,4 +7,5 @@ require (
 	github.com/google/go-github/v32 v32.1.0
 	github.com/spf13/cobra v1.1.1
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
+	sigs.k8s.io/yaml v1.4.0
 )
@@ -0,0 +1,352 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package policy
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "unicode"
+)
+
+// Kind is what a count of users is taken from
+type Kind int
+
+const (
+  // Approvals counts the users who approved the pull request
+  Approvals Kind = iota
+  // Reviews counts the users who reviewed the pull request
+  Reviews
+)
+
+// GroupKind is the type of a group of users
+type GroupKind int
+
+const (
+  // Team is a team of an organisation, e.g. `@unikraft/maintainers`
+  Team GroupKind = iota
+  // User is a single user, e.g. `@nderjung`
+  User
+  // Assignees are the users assigned to the pull request
+  Assignees
+  // RequestedReviewers are the users and teams whose review was requested
+  RequestedReviewers
+  // Anyone is any user
+  Anyone
+  // Named is a group defined outside of the policy
+  Named
+)
+
+// Group is a group of users named by the policy
+type Group struct {
+  Kind GroupKind
+  Name string
+}
+
+// ParseGroup parses a reference to a group, which is either a team as
+// `@org/team`, a user as `@user`, one of `assignees`, `requested_reviewers` or
+// `anyone`, or otherwise the name of a group defined outside of the policy
+func ParseGroup(s string) (Group, error) {
+  s = strings.TrimSpace(s)
+
+  switch {
+  case s == "":
+    return Group{}, fmt.Errorf("empty group")
+  case strings.HasPrefix(s, "@"):
+    parts := strings.Split(s[1:], "/")
+    for _, part := range parts {
+      if part == "" {
+        return Group{}, fmt.Errorf("invalid group: %s", s)
+      }
+    }
+
+    switch len(parts) {
+    case 1:
+      return Group{Kind: User, Name: parts[0]}, nil
+    case 2:
+      return Group{Kind: Team, Name: s[1:]}, nil
+    }
+
+    return Group{}, fmt.Errorf("invalid group: %s", s)
+  }
+
+  switch strings.ToLower(s) {
+  case "assignees":
+    return Group{Kind: Assignees}, nil
+  case "requested_reviewers":
+    return Group{Kind: RequestedReviewers}, nil
+  case "anyone":
+    return Group{Kind: Anyone}, nil
+  }
+
+  if isKeyword(s) || !unicode.IsLetter(rune(s[0])) {
+    return Group{}, fmt.Errorf("invalid group: %s", s)
+  }
+
+  for _, r := range s {
+    if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_-.", r) {
+      return Group{}, fmt.Errorf("invalid group: %s", s)
+    }
+  }
+
+  return Group{Kind: Named, Name: s}, nil
+}
+
+// String returns the group as it is referred to in a policy
+func (g Group) String() string {
+  switch g.Kind {
+  case Team, User:
+    return "@" + g.Name
+  case Assignees:
+    return "assignees"
+  case RequestedReviewers:
+    return "requested_reviewers"
+  case Anyone:
+    return "anyone"
+  }
+
+  return g.Name
+}
+
+// keywords are the words of the language which cannot name a group
+var keywords = []string{
+  "and", "or", "of", "approval", "approvals", "review", "reviews",
+}
+
+// isKeyword determines whether the word is a keyword of the language
+func isKeyword(s string) bool {
+  for _, k := range keywords {
+    if strings.EqualFold(k, s) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// tokenize splits the policy into parentheses, commas, `&&`, `||` and words
+func tokenize(s string) ([]string, error) {
+  var tokens []string
+
+  for i := 0; i < len(s); {
+    switch c := s[i]; {
+    case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+      i++
+    case c == '(' || c == ')' || c == ',':
+      tokens = append(tokens, string(c))
+      i++
+    case c == '&' || c == '|':
+      if i+1 >= len(s) || s[i+1] != c {
+        return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+      }
+      tokens = append(tokens, s[i:i+2])
+      i += 2
+    default:
+      j := i
+      for j < len(s) && strings.IndexByte(" \t\n\r(),&|", s[j]) < 0 {
+        j++
+      }
+      tokens = append(tokens, s[i:j])
+      i = j
+    }
+  }
+
+  return tokens, nil
+}
+
+// parser is a recursive descent parser over the tokens of a policy
+type parser struct {
+  tokens []string
+  pos    int
+}
+
+// peek returns the next token, or an empty string at the end of the policy
+func (p *parser) peek() string {
+  if p.pos >= len(p.tokens) {
+    return ""
+  }
+
+  return p.tokens[p.pos]
+}
+
+// next consumes and returns the next token
+func (p *parser) next() string {
+  token := p.peek()
+  p.pos++
+  return token
+}
+
+// accept consumes the next token if it is any of the given ones
+func (p *parser) accept(tokens ...string) bool {
+  for _, t := range tokens {
+    if strings.EqualFold(p.peek(), t) {
+      p.pos++
+      return true
+    }
+  }
+
+  return false
+}
+
+// Parse parses an approval policy, which combines counts of approvals or
+// reviews by groups of users with `and` and `or`, e.g.
+//
+//   2 of @unikraft/maintainers or (1 of @unikraft/leads and 1 of assignees)
+//
+// A count is a number, optionally followed by `approvals` (the default) or
+// `reviews`, then `of` and a comma-separated list of groups.  `and` binds
+// tighter than `or` and may also be written as `&&`, just as `or` as `||`.
+func Parse(s string) (*Policy, error) {
+  tokens, err := tokenize(s)
+  if err != nil {
+    return nil, fmt.Errorf("could not parse policy: %s", err)
+  }
+
+  if len(tokens) == 0 {
+    return nil, fmt.Errorf("could not parse policy: empty policy")
+  }
+
+  p := &parser{tokens: tokens}
+
+  root, err := p.parseOr()
+  if err != nil {
+    return nil, fmt.Errorf("could not parse policy: %s", err)
+  }
+
+  if p.peek() != "" {
+    return nil, fmt.Errorf("could not parse policy: unexpected %q", p.peek())
+  }
+
+  return &Policy{root: root}, nil
+}
+
+// parseOr parses clauses separated by `or`
+func (p *parser) parseOr() (Node, error) {
+  var clauses []Node
+
+  for {
+    clause, err := p.parseAnd()
+    if err != nil {
+      return nil, err
+    }
+
+    clauses = append(clauses, clause)
+
+    if !p.accept("or", "||") {
+      break
+    }
+  }
+
+  if len(clauses) == 1 {
+    return clauses[0], nil
+  }
+
+  return &Or{Clauses: clauses}, nil
+}
+
+// parseAnd parses terms separated by `and`
+func (p *parser) parseAnd() (Node, error) {
+  var clauses []Node
+
+  for {
+    clause, err := p.parseTerm()
+    if err != nil {
+      return nil, err
+    }
+
+    clauses = append(clauses, clause)
+
+    if !p.accept("and", "&&") {
+      break
+    }
+  }
+
+  if len(clauses) == 1 {
+    return clauses[0], nil
+  }
+
+  return &And{Clauses: clauses}, nil
+}
+
+// parseTerm parses a parenthesised clause or a count
+func (p *parser) parseTerm() (Node, error) {
+  if p.accept("(") {
+    clause, err := p.parseOr()
+    if err != nil {
+      return nil, err
+    }
+
+    if !p.accept(")") {
+      return nil, fmt.Errorf("expected ) but got %q", p.peek())
+    }
+
+    return clause, nil
+  }
+
+  return p.parseCount()
+}
+
+// parseCount parses a count of approvals or reviews by groups of users
+func (p *parser) parseCount() (Node, error) {
+  token := p.next()
+
+  n, err := strconv.Atoi(token)
+  if err != nil || n < 1 {
+    return nil, fmt.Errorf("expected a positive number but got %q", token)
+  }
+
+  count := &Count{N: n}
+
+  if p.accept("review", "reviews") {
+    count.Kind = Reviews
+  } else {
+    p.accept("approval", "approvals")
+  }
+
+  if !p.accept("of") {
+    return nil, fmt.Errorf("expected of but got %q", p.peek())
+  }
+
+  for {
+    group, err := ParseGroup(p.next())
+    if err != nil {
+      return nil, err
+    }
+
+    count.Groups = append(count.Groups, group)
+
+    if !p.accept(",") {
+      break
+    }
+  }
+
+  return count, nil
+}
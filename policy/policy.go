@@ -0,0 +1,337 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package policy
+
+import (
+  "fmt"
+  "strings"
+)
+
+// Resolver determines whether users belong to the groups named by a policy
+type Resolver interface {
+  IsMember(login string, group Group) (bool, error)
+}
+
+// Node is a clause of a policy
+type Node interface {
+  String() string
+}
+
+// Or is satisfied if any of its clauses is
+type Or struct {
+  Clauses []Node
+}
+
+// String returns the clauses separated by `or`
+func (o *Or) String() string {
+  var clauses []string
+  for _, clause := range o.Clauses {
+    clauses = append(clauses, clause.String())
+  }
+
+  return strings.Join(clauses, " or ")
+}
+
+// And is satisfied if all of its clauses are, where the counts among them must
+// be satisfied by distinct users
+type And struct {
+  Clauses []Node
+}
+
+// String returns the clauses separated by `and`
+func (a *And) String() string {
+  var clauses []string
+  for _, clause := range a.Clauses {
+    if _, ok := clause.(*Or); ok {
+      clauses = append(clauses, "(" + clause.String() + ")")
+    } else {
+      clauses = append(clauses, clause.String())
+    }
+  }
+
+  return strings.Join(clauses, " and ")
+}
+
+// Count is satisfied if at least N users of any of its groups have approved or
+// reviewed the pull request
+type Count struct {
+  N      int
+  Kind   Kind
+  Groups []Group
+}
+
+// String returns the count, e.g. `2 approvals of @org/team, @user`
+func (c *Count) String() string {
+  kind := "approval"
+  if c.Kind == Reviews {
+    kind = "review"
+  }
+
+  if c.N != 1 {
+    kind += "s"
+  }
+
+  var groups []string
+  for _, group := range c.Groups {
+    groups = append(groups, group.String())
+  }
+
+  return fmt.Sprintf("%d %s of %s", c.N, kind, strings.Join(groups, ", "))
+}
+
+// Policy is a parsed approval policy
+type Policy struct {
+  root Node
+}
+
+// String returns the policy in its canonical form
+func (p *Policy) String() string {
+  return p.root.String()
+}
+
+// Groups returns every group named by the policy
+func (p *Policy) Groups() []Group {
+  var groups []Group
+  var walk func(n Node)
+
+  walk = func(n Node) {
+    switch n := n.(type) {
+    case *Or:
+      for _, clause := range n.Clauses {
+        walk(clause)
+      }
+    case *And:
+      for _, clause := range n.Clauses {
+        walk(clause)
+      }
+    case *Count:
+      groups = append(groups, n.Groups...)
+    }
+  }
+
+  walk(p.root)
+
+  return groups
+}
+
+// Result is the outcome of evaluating a policy
+type Result struct {
+  Satisfied bool
+  // Clause is the first alternative of the policy which was satisfied
+  Clause    string
+}
+
+// evaluator evaluates the clauses of a policy, caching group memberships
+type evaluator struct {
+  users    map[Kind][]string
+  resolver Resolver
+  members  map[string]bool
+}
+
+// Evaluate determines whether the users who approved and reviewed the pull
+// request satisfy the policy, and if so which of its alternatives
+func (p *Policy) Evaluate(approvers, reviewers []string, resolver Resolver) (*Result, error) {
+  e := &evaluator{
+    users:    map[Kind][]string{
+      Approvals: unique(approvers),
+      Reviews:   unique(reviewers),
+    },
+    resolver: resolver,
+    members:  make(map[string]bool),
+  }
+
+  clauses := []Node{p.root}
+  if or, ok := p.root.(*Or); ok {
+    clauses = or.Clauses
+  }
+
+  for _, clause := range clauses {
+    ok, err := e.eval(clause)
+    if err != nil {
+      return nil, err
+    }
+
+    if ok {
+      return &Result{
+        Satisfied: true,
+        Clause:    clause.String(),
+      }, nil
+    }
+  }
+
+  return &Result{}, nil
+}
+
+// eval determines whether the clause is satisfied
+func (e *evaluator) eval(n Node) (bool, error) {
+  switch n := n.(type) {
+  case *Or:
+    for _, clause := range n.Clauses {
+      if ok, err := e.eval(clause); ok || err != nil {
+        return ok, err
+      }
+    }
+
+    return false, nil
+
+  case *And:
+    var counts []*Count
+
+    for _, clause := range n.Clauses {
+      if count, ok := clause.(*Count); ok {
+        counts = append(counts, count)
+        continue
+      }
+
+      if ok, err := e.eval(clause); !ok || err != nil {
+        return false, err
+      }
+    }
+
+    return e.assign(counts)
+
+  case *Count:
+    return e.assign([]*Count{n})
+  }
+
+  return false, fmt.Errorf("unknown clause: %s", n)
+}
+
+// eligible determines whether the user belongs to any of the groups of the
+// count
+func (e *evaluator) eligible(count *Count, login string) (bool, error) {
+  for _, group := range count.Groups {
+    key := group.String() + " " + login
+
+    ok, cached := e.members[key]
+    if !cached {
+      var err error
+      ok, err = e.resolver.IsMember(login, group)
+      if err != nil {
+        return false, err
+      }
+
+      e.members[key] = ok
+    }
+
+    if ok {
+      return true, nil
+    }
+  }
+
+  return false, nil
+}
+
+// assign determines whether every count can be satisfied at once without
+// counting any user twice, by matching users to the slots of each count along
+// augmenting paths
+func (e *evaluator) assign(counts []*Count) (bool, error) {
+  for _, kind := range []Kind{Approvals, Reviews} {
+    users := e.users[kind]
+
+    var slots [][]int
+    for _, count := range counts {
+      if count.Kind != kind {
+        continue
+      }
+
+      var eligible []int
+      for i, login := range users {
+        ok, err := e.eligible(count, login)
+        if err != nil {
+          return false, err
+        }
+
+        if ok {
+          eligible = append(eligible, i)
+        }
+      }
+
+      for i := 0; i < count.N; i++ {
+        slots = append(slots, eligible)
+      }
+    }
+
+    if len(slots) > len(users) {
+      return false, nil
+    }
+
+    matched := make([]int, len(users))
+    for i := range matched {
+      matched[i] = -1
+    }
+
+    for slot := range slots {
+      if !augment(slots, matched, slot, make([]bool, len(users))) {
+        return false, nil
+      }
+    }
+  }
+
+  return true, nil
+}
+
+// augment finds a user for the slot, possibly moving the users matched to other
+// slots along the way
+func augment(slots [][]int, matched []int, slot int, seen []bool) bool {
+  for _, user := range slots[slot] {
+    if seen[user] {
+      continue
+    }
+
+    seen[user] = true
+
+    if matched[user] < 0 || augment(slots, matched, matched[user], seen) {
+      matched[user] = slot
+      return true
+    }
+  }
+
+  return false
+}
+
+// unique returns the logins without duplicates, in their original order
+func unique(logins []string) []string {
+  var users []string
+  seen := make(map[string]bool)
+
+  for _, login := range logins {
+    key := strings.ToLower(login)
+    if seen[key] {
+      continue
+    }
+
+    seen[key] = true
+    users = append(users, login)
+  }
+
+  return users
+}
@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: BSD-3-Clause
+//
+// Authors: Alexander Jung <alex@nderjung.net>
+//
+// Copyright (c) 2020, Alexander Jung.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+package policy
+
+import (
+  "strings"
+  "testing"
+)
+
+// stubResolver resolves groups from a fixed list of members by group
+type stubResolver map[string][]string
+
+func (r stubResolver) IsMember(login string, group Group) (bool, error) {
+  if group.Kind == Anyone {
+    return true, nil
+  }
+
+  for _, member := range r[group.String()] {
+    if member == login {
+      return true, nil
+    }
+  }
+
+  return false, nil
+}
+
+func TestParseErrors(t *testing.T) {
+  tests := []struct {
+    policy string
+    err    string
+  }{
+    {"", "empty policy"},
+    {"2 of", "empty group"},
+    {"0 of @org/team", "expected a positive number"},
+    {"two of @org/team", "expected a positive number"},
+    {"2 @org/team", "expected of"},
+    {"1 of @org/team/sub", "invalid group"},
+    {"1 of @", "invalid group"},
+    {"1 of and", "invalid group"},
+    {"1 of 2leads", "invalid group"},
+    {"(1 of @org/team", "expected )"},
+    {"1 of @org/team)", "unexpected \")\""},
+    {"1 of @org/team & 1 of @user", "unexpected '&'"},
+    {"1 of @org/team or", "expected a positive number"},
+  }
+
+  for _, test := range tests {
+    _, err := Parse(test.policy)
+    if err == nil {
+      t.Errorf("Parse(%q): expected error containing %q", test.policy, test.err)
+      continue
+    }
+
+    if !strings.Contains(err.Error(), test.err) {
+      t.Errorf("Parse(%q): got %q, expected error containing %q", test.policy, err, test.err)
+    }
+  }
+}
+
+func TestParseString(t *testing.T) {
+  tests := []struct {
+    policy string
+    want   string
+  }{
+    {"1 of @org/team", "1 approval of @org/team"},
+    {"2 APPROVALS OF @org/team, @user", "2 approvals of @org/team, @user"},
+    {"1 review of requested_reviewers", "1 review of requested_reviewers"},
+    {"3 of anyone || 1 of assignees", "3 approvals of anyone or 1 approval of assignees"},
+    {
+      "1 of a or 1 of b and 1 of c",
+      "1 approval of a or 1 approval of b and 1 approval of c",
+    },
+    {
+      "(1 of a or 1 of b) && 1 of c",
+      "(1 approval of a or 1 approval of b) and 1 approval of c",
+    },
+    {"((1 of leads))", "1 approval of leads"},
+  }
+
+  for _, test := range tests {
+    p, err := Parse(test.policy)
+    if err != nil {
+      t.Errorf("Parse(%q): unexpected error: %s", test.policy, err)
+      continue
+    }
+
+    if got := p.String(); got != test.want {
+      t.Errorf("Parse(%q).String() = %q, expected %q", test.policy, got, test.want)
+    }
+
+    // The canonical form parses to itself
+    again, err := Parse(p.String())
+    if err != nil {
+      t.Errorf("Parse(%q): unexpected error: %s", p.String(), err)
+    } else if again.String() != test.want {
+      t.Errorf("Parse(%q).String() = %q, expected %q", p.String(), again.String(), test.want)
+    }
+  }
+}
+
+func TestParsePrecedence(t *testing.T) {
+  p, err := Parse("1 of a or 1 of b and 1 of c")
+  if err != nil {
+    t.Fatalf("unexpected error: %s", err)
+  }
+
+  or, ok := p.root.(*Or)
+  if !ok || len(or.Clauses) != 2 {
+    t.Fatalf("expected an or of two clauses, got %#v", p.root)
+  }
+
+  if _, ok := or.Clauses[1].(*And); !ok {
+    t.Errorf("expected and to bind tighter than or, got %#v", or.Clauses[1])
+  }
+}
+
+func TestEvaluate(t *testing.T) {
+  resolver := stubResolver{
+    "@org/leads":     {"alice", "bob"},
+    "@org/reviewers": {"alice", "carol"},
+    "@org/security":  {"dave"},
+  }
+
+  tests := []struct {
+    policy    string
+    approvers []string
+    reviewers []string
+    satisfied bool
+    clause    string
+  }{
+    {"1 of @org/leads", []string{"alice"}, nil, true, "1 approval of @org/leads"},
+    {"1 of @org/leads", []string{"carol"}, nil, false, ""},
+    {"2 of @org/leads", []string{"alice", "alice"}, nil, false, ""},
+    {"2 of @org/leads", []string{"alice", "bob"}, nil, true, "2 approvals of @org/leads"},
+
+    // Counts combined by and must be satisfied by distinct users
+    {"1 of @org/leads and 1 of @org/reviewers", []string{"alice"}, nil, false, ""},
+    {
+      "1 of @org/leads and 1 of @org/reviewers",
+      []string{"alice", "bob"},
+      nil,
+      true,
+      "1 approval of @org/leads and 1 approval of @org/reviewers",
+    },
+
+    // Matching has to move alice from the first count to the second
+    {
+      "1 of @org/leads and 1 of @org/reviewers and 1 of @org/security",
+      []string{"alice", "bob", "dave"},
+      nil,
+      true,
+      "1 approval of @org/leads and 1 approval of @org/reviewers and 1 approval of @org/security",
+    },
+    {
+      "1 of @org/reviewers, @org/security and 1 of @org/leads",
+      []string{"alice", "dave"},
+      nil,
+      true,
+      "1 approval of @org/reviewers, @org/security and 1 approval of @org/leads",
+    },
+
+    // Approvals and reviews are counted separately
+    {
+      "1 of @org/leads and 1 review of @org/leads",
+      []string{"alice"},
+      []string{"alice"},
+      true,
+      "1 approval of @org/leads and 1 review of @org/leads",
+    },
+    {"1 review of anyone", []string{"alice"}, nil, false, ""},
+
+    // The first satisfied alternative is reported
+    {
+      "2 of @org/leads or 1 of @org/security or 1 of anyone",
+      []string{"dave"},
+      nil,
+      true,
+      "1 approval of @org/security",
+    },
+    {
+      "(1 of @org/security or 1 of @org/leads) and 1 of @org/reviewers",
+      []string{"carol", "bob"},
+      nil,
+      true,
+      "(1 approval of @org/security or 1 approval of @org/leads) and 1 approval of @org/reviewers",
+    },
+  }
+
+  for _, test := range tests {
+    p, err := Parse(test.policy)
+    if err != nil {
+      t.Errorf("Parse(%q): unexpected error: %s", test.policy, err)
+      continue
+    }
+
+    result, err := p.Evaluate(test.approvers, test.reviewers, resolver)
+    if err != nil {
+      t.Errorf("Evaluate(%q): unexpected error: %s", test.policy, err)
+      continue
+    }
+
+    if result.Satisfied != test.satisfied || result.Clause != test.clause {
+      t.Errorf("Evaluate(%q, %v, %v) = %v %q, expected %v %q",
+        test.policy, test.approvers, test.reviewers,
+        result.Satisfied, result.Clause, test.satisfied, test.clause,
+      )
+    }
+  }
+}
+
+func TestGroups(t *testing.T) {
+  p, err := Parse("1 of leads, @org/team or 1 review of @user, assignees")
+  if err != nil {
+    t.Fatalf("unexpected error: %s", err)
+  }
+
+  var groups []string
+  for _, group := range p.Groups() {
+    groups = append(groups, group.String())
+  }
+
+  want := "leads @org/team @user assignees"
+  if got := strings.Join(groups, " "); got != want {
+    t.Errorf("Groups() = %q, expected %q", got, want)
+  }
+}